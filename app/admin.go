@@ -0,0 +1,199 @@
+package app
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// The admin API is served under /admin/ and authenticated with the
+// AdminCredential option, separately from the credentials of clients.
+//
+//   GET    admin/sessions               lists running sessions
+//   DELETE admin/sessions/<id>          closes a session with the CloseSignal option in background
+//   POST   admin/sessions/<id>/message  shows {"Message": "..."} to the clients of a session
+//   POST   admin/message                shows {"Message": "..."} to all clients
+//
+// Messages must be sent as application/json, which browsers don't send
+// to other sites without asking them first.
+
+type adminSessions struct {
+	Connections int64
+	Sessions    []adminSession
+}
+
+type adminSession struct {
+	ID        string
+	PID       int
+	Argv      []string
+	User      string
+	StartTime time.Time
+	// Input written to and output read from the backend
+	BytesIn  int64
+	BytesOut int64
+	Clients  []adminClient
+}
+
+type adminClient struct {
+	RemoteAddr string
+	User       string
+	Role       string
+}
+
+type adminMessage struct {
+	Message string
+}
+
+func (app *App) adminHandler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		path := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+		switch {
+		case len(path) == 1 && path[0] == "sessions":
+			if !allowMethod(w, r, "GET") {
+				return
+			}
+			writeJSON(w, r, app.adminSessions())
+
+		case len(path) == 2 && path[0] == "sessions":
+			if !allowMethod(w, r, "DELETE") {
+				return
+			}
+			session, ok := app.runningSession(path[1])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			// Commands ignoring the signal can take long to exit
+			go session.close("closed by admin API")
+			w.WriteHeader(http.StatusAccepted)
+
+		case len(path) == 3 && path[0] == "sessions" && path[2] == "message":
+			if !allowMethod(w, r, "POST") {
+				return
+			}
+			session, ok := app.runningSession(path[1])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			message, ok := readAdminMessage(w, r)
+			if !ok {
+				return
+			}
+			session.showMessage(message)
+			w.WriteHeader(http.StatusNoContent)
+
+		case len(path) == 1 && path[0] == "message":
+			if !allowMethod(w, r, "POST") {
+				return
+			}
+			message, ok := readAdminMessage(w, r)
+			if !ok {
+				return
+			}
+			for _, session := range app.runningSessions() {
+				session.showMessage(message)
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (app *App) adminSessions() adminSessions {
+	result := adminSessions{
+		Connections: atomic.LoadInt64(app.connections),
+		Sessions:    []adminSession{},
+	}
+	for _, session := range app.runningSessions() {
+		clients := []adminClient{}
+		for _, context := range session.attachedClients() {
+			clients = append(clients, adminClient{
+				RemoteAddr: context.remoteAddr,
+				User:       context.user,
+				Role:       context.role,
+			})
+		}
+		sort.Slice(clients, func(i, j int) bool { return clients[i].RemoteAddr < clients[j].RemoteAddr })
+
+		result.Sessions = append(result.Sessions, adminSession{
+			ID:        session.id,
+			PID:       session.pid(),
+			Argv:      session.argv,
+			User:      session.user,
+			StartTime: session.startTime,
+			BytesIn:   atomic.LoadInt64(session.bytesIn),
+			BytesOut:  atomic.LoadInt64(session.bytesOut),
+			Clients:   clients,
+		})
+	}
+	sort.Slice(result.Sessions, func(i, j int) bool {
+		return result.Sessions[i].StartTime.Before(result.Sessions[j].StartTime)
+	})
+	return result
+}
+
+func (app *App) runningSession(id string) (*session, bool) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	session, ok := app.sessions[id]
+	if !ok || session.closed() {
+		return nil, false
+	}
+	return session, true
+}
+
+func (app *App) runningSessions() []*session {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	sessions := []*session{}
+	for _, session := range app.sessions {
+		if !session.closed() {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+func readAdminMessage(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType != "application/json" {
+		http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+		return "", false
+	}
+	var message adminMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&message); err != nil || message.Message == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return "", false
+	}
+	return message.Message, true
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, value interface{}) {
+	response, err := json.Marshal(value)
+	if err != nil {
+		requestLogger(r).Error("Failed to encode response", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	options := DefaultOptions
+	app, err := New([]string{"cat"}, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := app.adminHandler("/admin/")
+
+	jsonType := "application/json"
+	cases := []struct {
+		method      string
+		path        string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"GET", "/admin/sessions", "", "", http.StatusOK},
+		{"POST", "/admin/sessions", "", "", http.StatusMethodNotAllowed},
+		{"DELETE", "/admin/sessions/unknown", "", "", http.StatusNotFound},
+		{"GET", "/admin/sessions/unknown", "", "", http.StatusMethodNotAllowed},
+		{"POST", "/admin/sessions/unknown/message", jsonType, `{"Message": "hello"}`, http.StatusNotFound},
+		{"POST", "/admin/message", jsonType, `{"Message": "hello"}`, http.StatusNoContent},
+		{"POST", "/admin/message", "application/json; charset=utf-8", `{"Message": "hello"}`, http.StatusNoContent},
+		{"POST", "/admin/message", jsonType, `{"Message": ""}`, http.StatusBadRequest},
+		{"POST", "/admin/message", jsonType, `hello`, http.StatusBadRequest},
+		{"POST", "/admin/message", "", `{"Message": "hello"}`, http.StatusUnsupportedMediaType},
+		{"POST", "/admin/message", "text/plain", `{"Message": "hello"}`, http.StatusUnsupportedMediaType},
+		{"GET", "/admin/message", "", "", http.StatusMethodNotAllowed},
+		{"GET", "/admin/unknown", "", "", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if c.contentType != "" {
+			r.Header.Set("Content-Type", c.contentType)
+		}
+		handler.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("expected %d for %s %s, got %d", c.code, c.method, c.path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/sessions", nil))
+	var sessions adminSessions
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+		t.Fatal(err)
+	}
+	if sessions.Connections != 0 || sessions.Sessions == nil || len(sessions.Sessions) != 0 {
+		t.Fatalf("expected no sessions, got %s", w.Body.String())
+	}
+}
+
+func TestAdminCloseSession(t *testing.T) {
+	options := DefaultOptions
+	options.AdminCredential = "admin:secret"
+	server, _ := newTestServer(t, options, nil, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "running")
+		<-ctx.Done()
+		// Slow to exit after the signal
+		time.Sleep(500 * time.Millisecond)
+		return 129
+	}))
+
+	conn := dialTestServer(t, server)
+	readMessage(t, conn, Output, "running")
+
+	request := func(method string, path string) *http.Response {
+		r, _ := http.NewRequest(method, server.URL+path, nil)
+		r.SetBasicAuth("admin", "secret")
+		response, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response := request("GET", "/admin/sessions")
+	var sessions adminSessions
+	err := json.NewDecoder(response.Body).Decode(&sessions)
+	response.Body.Close()
+	if err != nil || len(sessions.Sessions) != 1 {
+		t.Fatalf("expected a session, got %v %v", sessions, err)
+	}
+
+	start := time.Now()
+	response = request("DELETE", "/admin/sessions/"+sessions.Sessions[0].ID)
+	response.Body.Close()
+	if response.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected the session to be closed in background, got %d", response.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Fatalf("expected the response before the command exits, took %s", elapsed)
+	}
+	readMessage(t, conn, SetExitStatus, "129")
+}
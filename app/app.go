@@ -4,28 +4,25 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"math/big"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
-	"text/template"
 	"time"
 
 	"github.com/braintree/manners"
 	"github.com/elazarl/go-bindata-assetfs"
 	"github.com/gorilla/websocket"
-	"github.com/kr/pty"
 	"github.com/yudai/hcl"
 	"github.com/yudai/umutex"
 )
@@ -33,6 +30,8 @@ import (
 type InitMessage struct {
 	Arguments string `json:"Arguments,omitempty"`
 	AuthToken string `json:"AuthToken,omitempty"`
+	// ID of the session to reattach to
+	SessionID string `json:"SessionID,omitempty"`
 }
 
 type App struct {
@@ -42,42 +41,106 @@ type App struct {
 	upgrader *websocket.Upgrader
 	server   *manners.GracefulServer
 
-	titleTemplate *template.Template
+	// Authentication is disabled when empty
+	authenticators []Authenticator
+	// Guards authenticators, certificate and the options applied by Reload
+	reloadMutex *sync.RWMutex
+	// Served when the EnableTLS option is set
+	certificate *tls.Certificate
+	// Used instead of authenticators when the OIDCIssuer option is set
+	oidc *oidcProvider
+	// Issues tokens to authenticate websocket connections, nil when authentication is disabled
+	connectionTokens *connectionTokens
+	roles            *roles
+
+	// Commands and the paths they are served on
+	routes []*route
 
 	onceMutex *umutex.UnblockingMutex
 	timer     *time.Timer
 
+	// Recorded session to play instead of running a command
+	replay *asciicast
+
+	sessionMutex *sync.Mutex
+	// Running sessions keyed by their IDs
+	sessions map[string]*session
+	// Set when the server is exiting, no session can be started after it
+	sessionsClosed bool
+	// Set when the command failed to start, reported as exit code 127 in once mode
+	startFailed bool
+	// Used only when the Shared option is enabled, keyed by the command line
+	sharedSessions map[string]*session
+	// Closed when the shared session of the command line has been started or failed to start
+	sharedStarts map[string]chan bool
+
 	// clientContext writes concurrently
 	// Use atomic operations.
 	connections *int64
+
+	metrics   *metrics
+	logger    *slog.Logger
+	callbacks Callbacks
 }
 
 type Options struct {
-	Address             string                 `hcl:"address"`
-	Port                string                 `hcl:"port"`
-	PermitWrite         bool                   `hcl:"permit_write"`
-	EnableBasicAuth     bool                   `hcl:"enable_basic_auth"`
-	Credential          string                 `hcl:"credential"`
-	EnableRandomUrl     bool                   `hcl:"enable_random_url"`
-	RandomUrlLength     int                    `hcl:"random_url_length"`
-	IndexFile           string                 `hcl:"index_file"`
-	EnableTLS           bool                   `hcl:"enable_tls"`
-	TLSCrtFile          string                 `hcl:"tls_crt_file"`
-	TLSKeyFile          string                 `hcl:"tls_key_file"`
-	EnableTLSClientAuth bool                   `hcl:"enable_tls_client_auth"`
-	TLSCACrtFile        string                 `hcl:"tls_ca_crt_file"`
-	TitleFormat         string                 `hcl:"title_format"`
-	EnableReconnect     bool                   `hcl:"enable_reconnect"`
-	ReconnectTime       int                    `hcl:"reconnect_time"`
-	MaxConnection       int                    `hcl:"max_connection"`
-	Once                bool                   `hcl:"once"`
-	Timeout             int                    `hcl:"timeout"`
-	PermitArguments     bool                   `hcl:"permit_arguments"`
-	CloseSignal         int                    `hcl:"close_signal"`
-	Preferences         HtermPrefernces        `hcl:"preferences"`
-	RawPreferences      map[string]interface{} `hcl:"preferences"`
-	Width               int                    `hcl:"width"`
-	Height              int                    `hcl:"height"`
+	Address             string                    `hcl:"address"`
+	Port                string                    `hcl:"port"`
+	PermitWrite         bool                      `hcl:"permit_write"`
+	EnableBasicAuth     bool                      `hcl:"enable_basic_auth"`
+	Credential          string                    `hcl:"credential"`
+	HtpasswdFile        string                    `hcl:"htpasswd_file"`
+	TokenFile           string                    `hcl:"token_file"`
+	OIDCIssuer          string                    `hcl:"oidc_issuer"`
+	OIDCClientID        string                    `hcl:"oidc_client_id"`
+	OIDCClientSecret    string                    `hcl:"oidc_client_secret"`
+	OIDCRedirectURL     string                    `hcl:"oidc_redirect_url"`
+	OIDCAllowedDomains  string                    `hcl:"oidc_allowed_domains"`
+	OIDCAllowedGroups   string                    `hcl:"oidc_allowed_groups"`
+	Operators           string                    `hcl:"operators"`
+	Viewers             string                    `hcl:"viewers"`
+	AdminCredential     string                    `hcl:"admin_credential"`
+	EnableMetrics       bool                      `hcl:"enable_metrics"`
+	Commands            map[string]CommandOptions `hcl:"command"`
+	Users               map[string]UserOptions    `hcl:"user"`
+	EnableRandomUrl     bool                      `hcl:"enable_random_url"`
+	RandomUrlLength     int                       `hcl:"random_url_length"`
+	IndexFile           string                    `hcl:"index_file"`
+	EnableTLS           bool                      `hcl:"enable_tls"`
+	TLSCrtFile          string                    `hcl:"tls_crt_file"`
+	TLSKeyFile          string                    `hcl:"tls_key_file"`
+	EnableTLSClientAuth bool                      `hcl:"enable_tls_client_auth"`
+	TLSCACrtFile        string                    `hcl:"tls_ca_crt_file"`
+	SSHServerPort       string                    `hcl:"ssh_server_port"`
+	SSHServerHostKey    string                    `hcl:"ssh_server_host_key"`
+	TitleFormat         string                    `hcl:"title_format"`
+	EnableReconnect     bool                      `hcl:"enable_reconnect"`
+	ReconnectTime       int                       `hcl:"reconnect_time"`
+	MaxConnection       int                       `hcl:"max_connection"`
+	Once                bool                      `hcl:"once"`
+	PropagateExitCode   bool                      `hcl:"propagate_exit_code"`
+	Shared              bool                      `hcl:"shared"`
+	SessionGracePeriod  int                       `hcl:"session_grace_period"`
+	ScrollbackLines     int                       `hcl:"scrollback_lines"`
+	EnableSnapshot      bool                      `hcl:"enable_snapshot"`
+	RecordDir           string                    `hcl:"record_dir"`
+	EnableCompression   bool                      `hcl:"enable_compression"`
+	OutputLatency       int                       `hcl:"output_latency"`
+	OutputBufferSize    int                       `hcl:"output_buffer_size"`
+	Timeout             int                       `hcl:"timeout"`
+	PermitArguments     bool                      `hcl:"permit_arguments"`
+	Backend             string                    `hcl:"backend"`
+	SSHIdentityFile     string                    `hcl:"ssh_identity_file"`
+	SSHPassword         string                    `hcl:"ssh_password"`
+	SSHUseAgent         bool                      `hcl:"ssh_use_agent"`
+	SSHKnownHostsFile   string                    `hcl:"ssh_known_hosts_file"`
+	CloseSignal         int                       `hcl:"close_signal"`
+	Preferences         HtermPrefernces           `hcl:"preferences"`
+	RawPreferences      map[string]interface{}    `hcl:"preferences"`
+	Width               int                       `hcl:"width"`
+	Height              int                       `hcl:"height"`
+	LogFormat           string                    `hcl:"log_format"`
+	LogLevel            string                    `hcl:"log_level"`
 }
 
 var Version = "0.0.13"
@@ -88,6 +151,18 @@ var DefaultOptions = Options{
 	PermitWrite:         false,
 	EnableBasicAuth:     false,
 	Credential:          "",
+	HtpasswdFile:        "",
+	TokenFile:           "",
+	OIDCIssuer:          "",
+	OIDCClientID:        "",
+	OIDCClientSecret:    "",
+	OIDCRedirectURL:     "",
+	OIDCAllowedDomains:  "",
+	OIDCAllowedGroups:   "",
+	Operators:           "",
+	Viewers:             "",
+	AdminCredential:     "",
+	EnableMetrics:       false,
 	EnableRandomUrl:     false,
 	RandomUrlLength:     8,
 	IndexFile:           "",
@@ -96,21 +171,65 @@ var DefaultOptions = Options{
 	TLSKeyFile:          "~/.gotty.key",
 	EnableTLSClientAuth: false,
 	TLSCACrtFile:        "~/.gotty.ca.crt",
+	SSHServerPort:       "",
+	SSHServerHostKey:    "~/.gotty.ssh_host_key",
 	TitleFormat:         "GoTTY - {{ .Command }} ({{ .Hostname }})",
 	EnableReconnect:     false,
 	ReconnectTime:       10,
 	MaxConnection:       0,
 	Once:                false,
+	PropagateExitCode:   false,
+	Shared:              false,
+	SessionGracePeriod:  0,
+	ScrollbackLines:     1000,
+	EnableSnapshot:      false,
+	RecordDir:           "",
+	EnableCompression:   false,
+	OutputLatency:       0,
+	OutputBufferSize:    16384,
+	Backend:             "pty",
+	SSHIdentityFile:     "",
+	SSHPassword:         "",
+	SSHUseAgent:         false,
+	SSHKnownHostsFile:   "~/.ssh/known_hosts",
 	CloseSignal:         1, // syscall.SIGHUP
 	Preferences:         HtermPrefernces{},
 	Width:               0,
 	Height:              0,
+	LogFormat:           "text",
+	LogLevel:            "info",
 }
 
 func New(command []string, options *Options) (*App, error) {
-	titleTemplate, err := template.New("title").Parse(options.TitleFormat)
+	logger, err := NewLogger(os.Stderr, options)
 	if err != nil {
-		return nil, errors.New("Title format string syntax error")
+		return nil, err
+	}
+
+	routes, err := newRoutes(command, options)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticators, err := newAuthenticators(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var oidc *oidcProvider
+	if options.OIDCIssuer != "" {
+		oidc, err = newOIDCProvider(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tokens *connectionTokens
+	if oidc != nil || len(authenticators) > 0 {
+		tokens, err = newConnectionTokens()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	connections := int64(0)
@@ -119,54 +238,109 @@ func New(command []string, options *Options) (*App, error) {
 		command: command,
 		options: options,
 
+		authenticators: authenticators,
+		reloadMutex:    &sync.RWMutex{},
+		oidc:           oidc,
+
+		connectionTokens: tokens,
+		roles:            newRoles(options),
+
 		upgrader: &websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
-			Subprotocols:    []string{"gotty"},
+			Subprotocols:    []string{binaryProtocol, textProtocol},
+
+			EnableCompression: options.EnableCompression,
 		},
 
-		titleTemplate: titleTemplate,
+		routes: routes,
 
 		onceMutex:   umutex.New(),
 		connections: &connections,
+		metrics:     newMetrics(),
+		logger:      logger,
+
+		sessionMutex:   &sync.Mutex{},
+		sessions:       make(map[string]*session),
+		sharedSessions: make(map[string]*session),
+		sharedStarts:   make(map[string]chan bool),
 	}, nil
 }
 
-func ApplyConfigFile(options *Options, filePath string) error {
+// ApplyConfigFile decodes the config file over the options.
+// It returns a warning for each key of the file which is not an option,
+// to be logged once the options overriding the file, like flags, are applied.
+func ApplyConfigFile(options *Options, filePath string) ([]string, error) {
 	filePath = ExpandHomeDir(filePath)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return err
+		return nil, err
 	}
 
 	fileString := []byte{}
-	log.Printf("Loading config file at: %s", filePath)
 	fileString, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := hcl.Decode(options, string(fileString)); err != nil {
-		return err
+	object, err := hcl.Parse(string(fileString))
+	if err != nil {
+		return nil, err
+	}
+	if err := hcl.DecodeObject(options, object); err != nil {
+		return nil, err
 	}
 
-	return nil
+	// Typos would be silently ignored by the decoder
+	return unknownOptions("", object, reflect.TypeOf(Options{})), nil
 }
 
 func CheckConfig(options *Options) error {
 	if options.EnableTLSClientAuth && !options.EnableTLS {
 		return errors.New("TLS client authentication is enabled, but TLS is not enabled")
 	}
+	if options.OIDCIssuer != "" {
+		if options.OIDCClientID == "" {
+			return errors.New("OpenID Connect is enabled, but no client ID is given")
+		}
+		if options.EnableBasicAuth || options.HtpasswdFile != "" || options.TokenFile != "" {
+			return errors.New("OpenID Connect and Basic Authentication can't be enabled at the same time")
+		}
+	}
+	if err := checkRoutes(options); err != nil {
+		return err
+	}
+	if err := checkRoles(options); err != nil {
+		return err
+	}
+	if options.SSHServerPort != "" && options.OIDCIssuer != "" {
+		return errors.New("The SSH server can't authenticate users with OpenID Connect")
+	}
+	if options.PropagateExitCode && !options.Once {
+		return errors.New("Exit code propagation is available only with the once option")
+	}
+	if options.EnableMetrics && options.OIDCIssuer != "" && options.AdminCredential == "" {
+		return errors.New("Metrics can't be authenticated with OpenID Connect, give the admin credential for them")
+	}
+	if options.AdminCredential != "" && !strings.Contains(options.AdminCredential, ":") {
+		return errors.New("Admin credential must be given as user:pass")
+	}
+	if options.ScrollbackLines < 0 {
+		return errors.New("Scrollback lines must not be negative")
+	}
+	if options.OutputBufferSize <= 0 {
+		return errors.New("Output buffer size must be positive")
+	}
+	if _, err := backendFactory(options.Backend, options); err != nil {
+		return err
+	}
+	if _, err := NewLogger(ioutil.Discard, options); err != nil {
+		return err
+	}
 	return nil
 }
 
 func (app *App) Run() error {
-	if app.options.PermitWrite {
-		log.Printf("Permitting clients to write input to the PTY.")
-	}
-
-	if app.options.Once {
-		log.Printf("Once option is provided, accepting only one client")
-	}
+	app.logOptions()
 
 	path := ""
 	if app.options.EnableRandomUrl {
@@ -175,59 +349,27 @@ func (app *App) Run() error {
 
 	endpoint := net.JoinHostPort(app.options.Address, app.options.Port)
 
-	wsHandler := http.HandlerFunc(app.handleWS)
-	customIndexHandler := http.HandlerFunc(app.handleCustomIndex)
-	authTokenHandler := http.HandlerFunc(app.handleAuthToken)
-	staticHandler := http.FileServer(
-		&assetfs.AssetFS{Asset: Asset, AssetDir: AssetDir, Prefix: "static"},
-	)
-
-	var siteMux = http.NewServeMux()
-
-	if app.options.IndexFile != "" {
-		log.Printf("Using index file at " + app.options.IndexFile)
-		siteMux.Handle(path+"/", customIndexHandler)
-	} else {
-		siteMux.Handle(path+"/", http.StripPrefix(path+"/", staticHandler))
-	}
-	siteMux.Handle(path+"/auth_token.js", authTokenHandler)
-	siteMux.Handle(path+"/js/", http.StripPrefix(path+"/", staticHandler))
-	siteMux.Handle(path+"/favicon.png", http.StripPrefix(path+"/", staticHandler))
-
-	siteHandler := http.Handler(siteMux)
-
-	if app.options.EnableBasicAuth {
-		log.Printf("Using Basic Authentication")
-		siteHandler = wrapBasicAuth(siteHandler, app.options.Credential)
-	}
-
-	siteHandler = wrapHeaders(siteHandler)
-
-	wsMux := http.NewServeMux()
-	wsMux.Handle("/", siteHandler)
-	wsMux.Handle(path+"/ws", wsHandler)
-	siteHandler = (http.Handler(wsMux))
-
-	siteHandler = wrapLogger(siteHandler)
+	siteHandler := app.handler(path)
 
 	scheme := "http"
 	if app.options.EnableTLS {
 		scheme = "https"
 	}
-	log.Printf(
-		"Server is starting with command: %s",
-		strings.Join(app.command, " "),
-	)
+	if len(app.command) > 0 {
+		app.logger.Info("Server is starting", "command", app.command)
+	} else {
+		app.logger.Info("Server is starting", "commands", len(app.routes))
+	}
 	if app.options.Address != "" {
-		log.Printf(
-			"URL: %s",
-			(&url.URL{Scheme: scheme, Host: endpoint, Path: path + "/"}).String(),
+		app.logger.Info(
+			"Listening",
+			"url", (&url.URL{Scheme: scheme, Host: endpoint, Path: path + "/"}).String(),
 		)
 	} else {
 		for _, address := range listAddresses() {
-			log.Printf(
-				"URL: %s",
-				(&url.URL{
+			app.logger.Info(
+				"Listening",
+				"url", (&url.URL{
 					Scheme: scheme,
 					Host:   net.JoinHostPort(address, app.options.Port),
 					Path:   path + "/",
@@ -244,6 +386,21 @@ func (app *App) Run() error {
 		server,
 	)
 
+	if app.options.SSHServerPort != "" {
+		sshConfig, err := app.sshServerConfig()
+		if err != nil {
+			return errors.New("Failed to load SSH host key: " + err.Error())
+		}
+		sshEndpoint := net.JoinHostPort(app.options.Address, app.options.SSHServerPort)
+		listener, err := net.Listen("tcp", sshEndpoint)
+		if err != nil {
+			return err
+		}
+		defer listener.Close()
+		app.logger.Info("Listening for SSH", "address", listener.Addr().String())
+		go app.serveSSH(listener, sshConfig)
+	}
+
 	if app.options.Timeout > 0 {
 		app.timer = time.NewTimer(time.Duration(app.options.Timeout) * time.Second)
 		go func() {
@@ -255,10 +412,9 @@ func (app *App) Run() error {
 	if app.options.EnableTLS {
 		crtFile := ExpandHomeDir(app.options.TLSCrtFile)
 		keyFile := ExpandHomeDir(app.options.TLSKeyFile)
-		log.Printf("TLS crt file: " + crtFile)
-		log.Printf("TLS key file: " + keyFile)
+		app.logger.Info("Using TLS", "crt_file", crtFile, "key_file", keyFile)
 
-		err = app.server.ListenAndServeTLS(crtFile, keyFile)
+		err = app.listenAndServeTLS(endpoint)
 	} else {
 		err = app.server.ListenAndServe()
 	}
@@ -266,11 +422,117 @@ func (app *App) Run() error {
 		return err
 	}
 
-	log.Printf("Exiting...")
+	app.closeSessions("server exiting")
+
+	app.logger.Info("Exiting")
 
 	return nil
 }
 
+func (app *App) logOptions() {
+	if app.options.PermitWrite {
+		app.logger.Info("Permitting clients to write input to the PTY")
+	}
+
+	if app.options.Operators != "" || app.options.Viewers != "" {
+		app.logger.Info("Using roles", "operators", app.options.Operators, "viewers", app.options.Viewers)
+	}
+
+	if app.options.Once {
+		app.logger.Info("Once option is provided, accepting only one client")
+	}
+
+	if app.options.Shared {
+		app.logger.Info("Shared option is provided, all clients share a single process")
+	}
+
+	if app.options.SessionGracePeriod > 0 {
+		app.logger.Info("Keeping sessions after clients disconnect", "grace_period", app.options.SessionGracePeriod)
+	}
+
+	if app.options.RecordDir != "" {
+		app.logger.Info("Recording sessions", "dir", ExpandHomeDir(app.options.RecordDir))
+	}
+
+	if app.options.EnableCompression {
+		app.logger.Info("Using permessage-deflate compression when supported by clients")
+	}
+}
+
+// handler serves the commands under the path.
+func (app *App) handler(path string) http.Handler {
+	customIndexHandler := http.HandlerFunc(app.handleCustomIndex)
+	authTokenHandler := http.HandlerFunc(app.handleAuthToken)
+	authTokenScriptHandler := http.HandlerFunc(app.handleAuthTokenScript)
+	staticHandler := http.FileServer(
+		&assetfs.AssetFS{Asset: Asset, AssetDir: AssetDir, Prefix: "static"},
+	)
+
+	var siteMux = http.NewServeMux()
+
+	wsMux := http.NewServeMux()
+
+	if app.options.IndexFile != "" {
+		app.logger.Info("Using index file", "path", app.options.IndexFile)
+	}
+	if len(app.command) == 0 {
+		siteMux.Handle(path+"/", app.commandIndexHandler(path))
+		siteMux.Handle(path+"/favicon.png", http.StripPrefix(path+"/", staticHandler))
+	}
+	for _, route := range app.routes {
+		routePath := path + route.path
+		if app.options.IndexFile != "" {
+			siteMux.Handle(routePath, customIndexHandler)
+		} else {
+			siteMux.Handle(routePath, http.StripPrefix(routePath, staticHandler))
+		}
+		siteMux.Handle(routePath+"auth_token", authTokenHandler)
+		siteMux.Handle(routePath+"auth_token.js", authTokenScriptHandler)
+		if app.options.EnableSnapshot {
+			siteMux.Handle(routePath+"snapshot", app.snapshotHandler(route))
+		}
+		siteMux.Handle(routePath+"js/", http.StripPrefix(routePath, staticHandler))
+		siteMux.Handle(routePath+"favicon.png", http.StripPrefix(routePath, staticHandler))
+
+		wsMux.Handle(routePath+"ws", app.wsHandler(route))
+
+		if route.name != "" {
+			app.logger.Info("Serving command", "name", route.name, "path", routePath, "command", route.command)
+		}
+	}
+
+	siteHandler := http.Handler(siteMux)
+
+	if app.oidc != nil {
+		app.logger.Info("Using OpenID Connect Authentication", "issuer", app.options.OIDCIssuer)
+		siteHandler = wrapOIDC(siteHandler, app.oidc, path, app.metrics)
+	} else if len(app.authenticators) > 0 {
+		app.logger.Info("Using Basic Authentication")
+		siteHandler = wrapBasicAuth(siteHandler, app.currentAuthenticators, app.metrics)
+	}
+
+	siteHandler = wrapHeaders(siteHandler)
+
+	wsMux.Handle("/", siteHandler)
+	if app.options.AdminCredential != "" {
+		app.logger.Info("Serving the admin API", "path", path+"/admin/")
+		adminHandler := wrapBasicAuth(app.adminHandler(path+"/admin/"), app.adminAuthenticators, app.metrics)
+		wsMux.Handle(path+"/admin/", wrapHeaders(adminHandler))
+	}
+	if app.options.EnableMetrics {
+		app.logger.Info("Serving metrics", "path", path+"/metrics")
+		metricsHandler := http.Handler(http.HandlerFunc(app.handleMetrics))
+		if app.options.AdminCredential != "" {
+			metricsHandler = wrapBasicAuth(metricsHandler, app.adminAuthenticators, app.metrics)
+		} else if len(app.authenticators) > 0 {
+			metricsHandler = wrapBasicAuth(metricsHandler, app.currentAuthenticators, app.metrics)
+		}
+		wsMux.Handle(path+"/metrics", wrapHeaders(metricsHandler))
+	}
+	return wrapLogger(wsMux, app.logger)
+
+}
+
 func (app *App) makeServer(addr string, handler *http.Handler) (*http.Server, error) {
 	server := &http.Server{
 		Addr:    addr,
@@ -279,7 +541,7 @@ func (app *App) makeServer(addr string, handler *http.Handler) (*http.Server, er
 
 	if app.options.EnableTLSClientAuth {
 		caFile := ExpandHomeDir(app.options.TLSCACrtFile)
-		log.Printf("CA file: " + caFile)
+		app.logger.Info("Using TLS client authentication", "ca_file", caFile)
 		caCert, err := ioutil.ReadFile(caFile)
 		if err != nil {
 			return nil, errors.New("Could not open CA crt file " + caFile)
@@ -299,141 +561,315 @@ func (app *App) makeServer(addr string, handler *http.Handler) (*http.Server, er
 }
 
 func (app *App) stopTimer() {
-	if app.options.Timeout > 0 {
+	if app.timer != nil {
 		app.timer.Stop()
 	}
 }
 
 func (app *App) restartTimer() {
-	if app.options.Timeout > 0 {
+	if app.timer != nil {
 		app.timer.Reset(time.Duration(app.options.Timeout) * time.Second)
 	}
 }
 
-func (app *App) handleWS(w http.ResponseWriter, r *http.Request) {
+func (app *App) wsHandler(route *route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.handleWS(w, r, route)
+	})
+}
+
+func (app *App) handleWS(w http.ResponseWriter, r *http.Request, route *route) {
 	app.stopTimer()
+	logger := requestLogger(r).With("remote_addr", r.RemoteAddr)
 
 	connections := atomic.AddInt64(app.connections, 1)
-	if int64(app.options.MaxConnection) != 0 {
-		if connections >= int64(app.options.MaxConnection) {
-			log.Printf("Reached max connection: %d", app.options.MaxConnection)
+	if maxConnection := app.maxConnection(); maxConnection != 0 {
+		if connections >= int64(maxConnection) {
+			logger.Warn("Reached max connection", "max_connection", maxConnection)
+			app.rejectConnection("max_connection")
 			return
 		}
 	}
-	log.Printf("New client connected: %s", r.RemoteAddr)
+	logger.Info("New client connected", "path", r.URL.Path)
+
+	if app.closing() {
+		logger.Warn("Server is exiting")
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		app.rejectConnection("exiting")
+		return
+	}
 
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", 405)
+		app.rejectConnection("bad_request")
 		return
 	}
 
 	conn, err := app.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Print("Failed to upgrade connection: " + err.Error())
+		logger.Warn("Failed to upgrade connection", "error", err)
+		app.rejectConnection("bad_request")
 		return
 	}
 
 	_, stream, err := conn.ReadMessage()
 	if err != nil {
-		log.Print("Failed to authenticate websocket connection")
+		logger.Warn("Failed to read init message", "error", err)
 		conn.Close()
+		app.rejectConnection("bad_init_message")
 		return
 	}
 	var init InitMessage
 
 	err = json.Unmarshal(stream, &init)
 	if err != nil {
-		log.Printf("Failed to parse init message %v", err)
+		logger.Warn("Failed to parse init message", "error", err)
 		conn.Close()
+		app.rejectConnection("bad_init_message")
 		return
 	}
-	if init.AuthToken != app.options.Credential {
-		log.Print("Failed to authenticate websocket connection")
-		conn.Close()
-		return
+	user := ""
+	if app.connectionTokens != nil {
+		var ok bool
+		user, ok = app.connectionTokens.redeem(init.AuthToken)
+		if !ok {
+			logger.Warn("Failed to authenticate websocket connection")
+			conn.Close()
+			app.rejectConnection("auth")
+			return
+		}
+		// Tokens are only a second factor when logged in with OpenID Connect,
+		// the session cookie must still be valid and of the same user
+		if app.oidc != nil {
+			if sessionUser, ok := app.oidc.authenticate(r); !ok || sessionUser != user {
+				logger.Warn("Failed to authenticate websocket connection", "reason", "session")
+				conn.Close()
+				app.rejectConnection("auth")
+				return
+			}
+		}
+		logger.Info("Authenticated websocket connection", "user", user)
 	}
-	argv := app.command[1:]
+	role := app.roles.of(user, route.permitWrite)
+	logger = logger.With("user", user, "role", role)
+
+	command := app.commandFor(route, user)
+	argv := command
 	if app.options.PermitArguments {
 		if init.Arguments == "" {
 			init.Arguments = "?"
 		}
 		query, err := url.Parse(init.Arguments)
 		if err != nil {
-			log.Print("Failed to parse arguments")
+			logger.Warn("Failed to parse arguments", "error", err)
 			conn.Close()
+			app.rejectConnection("bad_init_message")
 			return
 		}
 		params := query.Query()["arg"]
 		if len(params) != 0 {
-			argv = append(argv, params...)
+			argv = append(append([]string{}, command...), params...)
 		}
 	}
 
-	app.server.StartRoutine()
+	context := &clientContext{
+		app:        app,
+		remoteAddr: r.RemoteAddr,
+		logger:     logger,
+		user:       user,
+		role:       role,
+		route:      route,
+		connection: conn,
+		writeMutex: &sync.Mutex{},
+		binary:     conn.Subprotocol() == binaryProtocol,
+	}
+	app.handleClient(context, command, argv, init.SessionID, connections)
+}
+
+// handleClient starts, joins or reattaches the session of an authenticated client
+// and serves the client. The connection is closed when the client is rejected.
+func (app *App) handleClient(context *clientContext, command []string, argv []string, sessionID string, connections int64) {
+	logger := context.logger
+	route := context.route
+	user := context.user
+	conn := context.connection
+
+	app.startRoutine()
 
 	if app.options.Once {
 		if app.onceMutex.TryLock() { // no unlock required, it will die soon
-			log.Printf("Last client accepted, closing the listener.")
+			logger.Info("Last client accepted, closing the listener")
 			app.server.Close()
 		} else {
-			log.Printf("Server is already closing.")
+			logger.Warn("Server is already closing")
 			conn.Close()
+			app.finishRoutine()
+			app.rejectConnection("once")
 			return
 		}
 	}
 
-	cmd := exec.Command(app.command[0], argv...)
-	ptyIo, err := pty.Start(cmd)
-	if err != nil {
-		log.Print("Failed to execute command")
+	if app.replay != nil {
+		logger.Info("Replaying recording", "file", app.command[1])
+		context.goHandleReplay()
 		return
 	}
 
-	if app.options.MaxConnection != 0 {
-		log.Printf("Command is running for client %s with PID %d (args=%q), connections: %d/%d",
-			r.RemoteAddr, cmd.Process.Pid, strings.Join(argv, " "), connections, app.options.MaxConnection)
-	} else {
-		log.Printf("Command is running for client %s with PID %d (args=%q), connections: %d",
-			r.RemoteAddr, cmd.Process.Pid, strings.Join(argv, " "), connections)
+	var session *session
+	var err error
+	reattach := false
+	if sessionID != "" && app.options.SessionGracePeriod > 0 {
+		session, reattach = app.reattachSession(sessionID, route, user)
 	}
-
-	context := &clientContext{
-		app:        app,
-		request:    r,
-		connection: conn,
-		command:    cmd,
-		pty:        ptyIo,
-		writeMutex: &sync.Mutex{},
+	if !reattach {
+		session, err = app.acquireSession(route, user, command, argv)
+		if err == errArgumentsMismatch {
+			logger.Warn("Rejected arguments differing from the shared process", "argv", argv)
+			context.write(append([]byte{ShowMessage}, err.Error()...))
+			app.finishRoutine()
+			conn.Close()
+			app.rejectConnection("arguments")
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to execute command", "argv", argv, "error", err)
+			app.sessionMutex.Lock()
+			app.startFailed = true
+			app.sessionMutex.Unlock()
+			if app.callbacks.OnError != nil {
+				app.callbacks.OnError(err)
+			}
+			app.finishRoutine()
+			conn.Close()
+			app.rejectConnection("command")
+			return
+		}
 	}
 
+	context.logger = logger.With("session", session.id)
+	context.logger.Info("Client attached",
+		"pid", session.pid(), "argv", session.argv, "reattach", reattach, "connections", connections)
+	context.session = session
+
 	context.goHandleClient()
 }
 
+// rejectConnection releases a connection counted in handleWS which is not handled by a client.
+func (app *App) rejectConnection(reason string) {
+	app.metrics.connectionRejected(reason)
+	if atomic.AddInt64(app.connections, -1) == 0 {
+		app.restartTimer()
+	}
+}
+
 func (app *App) handleCustomIndex(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, ExpandHomeDir(app.options.IndexFile))
 }
 
+// handleAuthToken issues a token for the client to open a websocket connection with.
+// The request has already passed HTTP authentication.
 func (app *App) handleAuthToken(w http.ResponseWriter, r *http.Request) {
+	token, ok := app.issueAuthToken(w, r)
+	if !ok {
+		return
+	}
+
+	response, _ := json.Marshal(struct{ Token string }{token})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(response)
+}
+
+// handleAuthTokenScript issues a token as the gotty_auth_token variable
+// for custom index pages which load auth_token.js like former versions.
+func (app *App) handleAuthTokenScript(w http.ResponseWriter, r *http.Request) {
+	token, ok := app.issueAuthToken(w, r)
+	if !ok {
+		return
+	}
+
+	// Escapes <, > and & as well
+	literal, _ := json.Marshal(token)
 	w.Header().Set("Content-Type", "application/javascript")
-	w.Write([]byte("var gotty_auth_token = '" + app.options.Credential + "';"))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("var gotty_auth_token = " + string(literal) + ";"))
+}
+
+// issueAuthToken returns a new token for the user of the request, or an empty token
+// when authentication is disabled. It writes an error response when it fails.
+func (app *App) issueAuthToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if app.connectionTokens == nil {
+		return "", true
+	}
+	user, ok := app.authenticateRequest(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	token, err := app.connectionTokens.issue(user)
+	if err != nil {
+		requestLogger(r).Error("Failed to issue auth token", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return "", false
+	}
+	return token, true
+}
+
+// authenticateRequest returns the user authenticated by the OIDC session cookie
+// or the Authorization header of the request.
+func (app *App) authenticateRequest(r *http.Request) (string, bool) {
+	if app.oidc != nil {
+		return app.oidc.authenticate(r)
+	}
+	credential, ok := requestCredential(r)
+	if !ok {
+		return "", false
+	}
+	return authenticateCredential(app.currentAuthenticators(), credential)
+}
+
+// ExitCode returns the exit code of the command run for the client in once mode,
+// 128+N when it has been killed by signal N and 127 when it failed to start.
+// It returns false when no command has exited.
+func (app *App) ExitCode() (int, bool) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	if app.startFailed {
+		return 127, true
+	}
+	for _, session := range app.sessions {
+		if session.closed() {
+			return session.exit.Code, true
+		}
+	}
+	return 0, false
+}
+
+// Logger returns the logger writing in the format and the level given by the options.
+func (app *App) Logger() *slog.Logger {
+	return app.logger
 }
 
 func (app *App) Exit() (firstCall bool) {
 	if app.server != nil {
 		firstCall = app.server.Close()
 		if firstCall {
-			log.Printf("Received Exit command, waiting for all clients to close sessions...")
+			app.logger.Info("Received Exit command, waiting for all clients to close sessions")
 		}
 		return firstCall
 	}
 	return true
 }
 
-func wrapLogger(handler http.Handler) http.Handler {
+// wrapLogger assigns an ID to each request to log it with.
+func wrapLogger(handler http.Handler, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestLogger := logger.With("request", generateRandomString(12))
 		rw := &responseWrapper{w, 200}
-		handler.ServeHTTP(rw, r)
-		log.Printf("%s %d %s %s", r.RemoteAddr, rw.status, r.Method, r.URL.Path)
+		handler.ServeHTTP(rw, withRequestLogger(r, requestLogger))
+		requestLogger.Info("HTTP request",
+			"remote_addr", r.RemoteAddr, "status", rw.status, "method", r.Method, "path", r.URL.Path)
 	})
 }
 
@@ -444,29 +880,27 @@ func wrapHeaders(handler http.Handler) http.Handler {
 	})
 }
 
-func wrapBasicAuth(handler http.Handler, credential string) http.Handler {
+// wrapBasicAuth requires a credential accepted by the authenticators for the handler.
+// Wrong credentials are counted in the metrics.
+func wrapBasicAuth(handler http.Handler, authenticators func() []Authenticator, metrics *metrics) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
-
-		if len(token) != 2 || strings.ToLower(token[0]) != "basic" {
+		credential, ok := requestCredential(r)
+		if !ok {
 			w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
 			http.Error(w, "Bad Request", http.StatusUnauthorized)
 			return
 		}
 
-		payload, err := base64.StdEncoding.DecodeString(token[1])
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		if credential != string(payload) {
+		user, ok := authenticateCredential(authenticators(), credential)
+		if !ok {
+			requestLogger(r).Warn("Basic Authentication failed", "remote_addr", r.RemoteAddr)
+			metrics.connectionRejected("auth")
 			w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
 			http.Error(w, "authorization failed", http.StatusUnauthorized)
 			return
 		}
 
-		log.Printf("Basic Authentication Succeeded: %s", r.RemoteAddr)
+		requestLogger(r).Info("Basic Authentication Succeeded", "remote_addr", r.RemoteAddr, "user", user)
 		handler.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,205 @@
+package app
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator verifies credentials presented by clients.
+type Authenticator interface {
+	// AuthenticatePassword returns true when the password is valid for the user.
+	AuthenticatePassword(username string, password string) bool
+	// AuthenticateToken returns the name of the user the token is issued for.
+	AuthenticateToken(token string) (username string, ok bool)
+}
+
+// credentialAuthenticator accepts the single user:pass given by the Credential option.
+type credentialAuthenticator struct {
+	username string
+	password string
+}
+
+func newCredentialAuthenticator(credential string) *credentialAuthenticator {
+	parts := strings.SplitN(credential, ":", 2)
+	if len(parts) != 2 {
+		return &credentialAuthenticator{username: credential}
+	}
+	return &credentialAuthenticator{username: parts[0], password: parts[1]}
+}
+
+func (auth *credentialAuthenticator) AuthenticatePassword(username string, password string) bool {
+	return secureCompare(username, auth.username) && secureCompare(password, auth.password)
+}
+
+func (auth *credentialAuthenticator) AuthenticateToken(token string) (string, bool) {
+	return "", false
+}
+
+// htpasswdAuthenticator accepts users in an htpasswd file with bcrypt hashes,
+// as generated by `htpasswd -B`.
+type htpasswdAuthenticator struct {
+	hashes map[string][]byte
+}
+
+func newHtpasswdAuthenticator(path string) (*htpasswdAuthenticator, error) {
+	entries, err := readCredentialFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string][]byte)
+	for username, hash := range entries {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, errors.New("Unsupported password hash for user " + username + " in " + path + ", only bcrypt is supported")
+		}
+		hashes[username] = []byte(hash)
+	}
+	return &htpasswdAuthenticator{hashes: hashes}, nil
+}
+
+func (auth *htpasswdAuthenticator) AuthenticatePassword(username string, password string) bool {
+	hash, ok := auth.hashes[username]
+	if !ok {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+func (auth *htpasswdAuthenticator) AuthenticateToken(token string) (string, bool) {
+	return "", false
+}
+
+// tokenAuthenticator accepts static tokens listed in a file as user:token lines.
+type tokenAuthenticator struct {
+	tokens map[string]string
+}
+
+func newTokenAuthenticator(path string) (*tokenAuthenticator, error) {
+	tokens, err := readCredentialFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenAuthenticator{tokens: tokens}, nil
+}
+
+func (auth *tokenAuthenticator) AuthenticatePassword(username string, password string) bool {
+	return false
+}
+
+func (auth *tokenAuthenticator) AuthenticateToken(token string) (string, bool) {
+	found := ""
+	// Compare with all the tokens to take the same time regardless of the result
+	for username, candidate := range auth.tokens {
+		if secureCompare(token, candidate) {
+			found = username
+		}
+	}
+	return found, found != ""
+}
+
+func newAuthenticators(options *Options) ([]Authenticator, error) {
+	authenticators := []Authenticator{}
+
+	if options.EnableBasicAuth {
+		authenticators = append(authenticators, newCredentialAuthenticator(options.Credential))
+	}
+	if options.HtpasswdFile != "" {
+		auth, err := newHtpasswdAuthenticator(ExpandHomeDir(options.HtpasswdFile))
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, auth)
+	}
+	if options.TokenFile != "" {
+		auth, err := newTokenAuthenticator(ExpandHomeDir(options.TokenFile))
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, auth)
+	}
+
+	return authenticators, nil
+}
+
+// authenticationEnabled returns whether clients are authenticated and so have user names.
+func authenticationEnabled(options *Options) bool {
+	return options.OIDCIssuer != "" || options.EnableBasicAuth || options.HtpasswdFile != "" || options.TokenFile != ""
+}
+
+// authenticateCredential verifies a user:pass pair or a token,
+// and returns the name of the authenticated user.
+func authenticateCredential(authenticators []Authenticator, credential string) (string, bool) {
+	if parts := strings.SplitN(credential, ":", 2); len(parts) == 2 {
+		for _, auth := range authenticators {
+			if auth.AuthenticatePassword(parts[0], parts[1]) {
+				return parts[0], true
+			}
+		}
+	}
+	for _, auth := range authenticators {
+		if username, ok := auth.AuthenticateToken(credential); ok {
+			return username, true
+		}
+	}
+	return "", false
+}
+
+// requestCredential extracts user:pass of Basic or the token of Bearer
+// from the Authorization header.
+func requestCredential(r *http.Request) (string, bool) {
+	token := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(token) != 2 {
+		return "", false
+	}
+
+	switch strings.ToLower(token[0]) {
+	case "basic":
+		payload, err := base64.StdEncoding.DecodeString(token[1])
+		if err != nil {
+			return "", false
+		}
+		return string(payload), true
+	case "bearer":
+		return token[1], true
+	default:
+		return "", false
+	}
+}
+
+// readCredentialFile reads name:value lines, skipping blank lines and # comments.
+func readCredentialFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("Malformed line in " + path)
+		}
+		entries[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func secureCompare(given string, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(actual)) == 1
+}
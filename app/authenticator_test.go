@@ -0,0 +1,102 @@
+package app
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeCredentialFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "credentials")
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestAuthenticateCredential(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultOptions
+	options.EnableBasicAuth = true
+	options.Credential = "admin:pass"
+	options.HtpasswdFile = writeCredentialFile(t, "# users\n\nalice:"+string(hash)+"\n")
+	options.TokenFile = writeCredentialFile(t, "bob:0123456789abcdef\n")
+	authenticators, err := newAuthenticators(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		credential string
+		user       string
+		ok         bool
+	}{
+		"credential":        {"admin:pass", "admin", true},
+		"credential wrong":  {"admin:wrong", "", false},
+		"htpasswd":          {"alice:secret", "alice", true},
+		"htpasswd wrong":    {"alice:pass", "", false},
+		"htpasswd unknown":  {"carol:secret", "", false},
+		"token":             {"0123456789abcdef", "bob", true},
+		"token as password": {"bob:0123456789abcdef", "", false},
+		"token wrong":       {"0123456789", "", false},
+		"empty":             {"", "", false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			user, ok := authenticateCredential(authenticators, c.credential)
+			if user != c.user || ok != c.ok {
+				t.Fatalf("expected %q %v, got %q %v", c.user, c.ok, user, ok)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorsErrors(t *testing.T) {
+	cases := map[string]Options{
+		"htpasswd missing": {HtpasswdFile: filepath.Join(t.TempDir(), "missing")},
+		"htpasswd md5":     {HtpasswdFile: writeCredentialFile(t, "alice:$apr1$abcdefgh$0123456789abcdefghijkl\n")},
+		"token malformed":  {TokenFile: writeCredentialFile(t, "bob\n")},
+		"token empty":      {TokenFile: writeCredentialFile(t, "bob:\n")},
+	}
+	for name, options := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newAuthenticators(&options); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestRequestCredential(t *testing.T) {
+	cases := map[string]struct {
+		header     string
+		credential string
+		ok         bool
+	}{
+		"basic":          {"Basic YWxpY2U6c2VjcmV0", "alice:secret", true},
+		"basic invalid":  {"Basic !!!", "", false},
+		"bearer":         {"Bearer 0123456789abcdef", "0123456789abcdef", true},
+		"bearer lower":   {"bearer 0123456789abcdef", "0123456789abcdef", true},
+		"unknown scheme": {"Digest username=alice", "", false},
+		"none":           {"", "", false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			if c.header != "" {
+				r.Header.Set("Authorization", c.header)
+			}
+			credential, ok := requestCredential(r)
+			if credential != c.credential || ok != c.ok {
+				t.Fatalf("expected %q %v, got %q %v", c.credential, c.ok, credential, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/kr/pty"
+)
+
+// Backend is what a session runs on, a command on a PTY by default.
+// Output is read from it and input from clients is written to it.
+type Backend interface {
+	io.ReadWriter
+	// Resize changes the size of the terminal, if any
+	Resize(columns int, rows int) error
+	// Close stops the backend, after which Read fails
+	Close() error
+	// Wait blocks until the backend has stopped and returns how it stopped
+	Wait() ExitStatus
+	// Pid returns the ID of the process, 0 when it's not a process
+	Pid() int
+}
+
+// BackendFactory starts a backend for a session with the command line of the session.
+type BackendFactory interface {
+	Start(argv []string) (Backend, error)
+}
+
+// BackendFactoryFunc is a function used as a BackendFactory.
+type BackendFactoryFunc func(argv []string) (Backend, error)
+
+func (f BackendFactoryFunc) Start(argv []string) (Backend, error) {
+	return f(argv)
+}
+
+// ExitStatus is how a backend has stopped.
+type ExitStatus struct {
+	// Exit code of the command, 128+N when killed by signal N
+	Code int
+	// Signal which killed the command, 0 when it exited by itself
+	Signal int
+}
+
+var (
+	backendsMutex = &sync.Mutex{}
+	backends      = map[string]BackendFactory{}
+)
+
+// RegisterBackend makes a backend available by the name for the Backend option
+// and the backend of commands.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	backends[name] = factory
+}
+
+// backendFactory returns the backend of the name, one of the built-in backends
+// or a backend registered with RegisterBackend.
+func backendFactory(name string, options *Options) (BackendFactory, error) {
+	switch name {
+	case "", "pty":
+		return &ptyBackendFactory{closeSignal: syscall.Signal(options.CloseSignal)}, nil
+	case "ssh":
+		return newSSHBackendFactory(options)
+	case "tcp", "unix":
+		return &socketBackendFactory{network: name}, nil
+	}
+
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	if factory, ok := backends[name]; ok {
+		return factory, nil
+	}
+
+	names := []string{"pty", "ssh", "tcp", "unix"}
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names[4:])
+	return nil, errors.New("Unknown backend " + name + ", must be one of " + strings.Join(names, ", "))
+}
+
+// ptyBackendFactory runs the command line on a new PTY.
+type ptyBackendFactory struct {
+	// Sent to the command when the backend is closed
+	closeSignal syscall.Signal
+}
+
+type ptyBackend struct {
+	command     *exec.Cmd
+	pty         *os.File
+	closeSignal syscall.Signal
+}
+
+func (factory *ptyBackendFactory) Start(argv []string) (Backend, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	ptyIo, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &ptyBackend{command: cmd, pty: ptyIo, closeSignal: factory.closeSignal}, nil
+}
+
+func (backend *ptyBackend) Read(p []byte) (int, error) {
+	return backend.pty.Read(p)
+}
+
+func (backend *ptyBackend) Write(p []byte) (int, error) {
+	return backend.pty.Write(p)
+}
+
+func (backend *ptyBackend) Resize(columns int, rows int) error {
+	window := struct {
+		row uint16
+		col uint16
+		x   uint16
+		y   uint16
+	}{
+		uint16(rows),
+		uint16(columns),
+		0,
+		0,
+	}
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		backend.pty.Fd(),
+		syscall.TIOCSWINSZ,
+		uintptr(unsafe.Pointer(&window)),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (backend *ptyBackend) Close() error {
+	err := backend.pty.Close()
+
+	// Even if the PTY has been closed,
+	// Read() in processOutput() keeps blocking and the process doen't exit
+	backend.command.Process.Signal(backend.closeSignal)
+
+	return err
+}
+
+func (backend *ptyBackend) Wait() ExitStatus {
+	backend.command.Wait()
+
+	state := backend.command.ProcessState
+	if state == nil {
+		return ExitStatus{Code: -1}
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return ExitStatus{Code: 128 + int(status.Signal()), Signal: int(status.Signal())}
+	}
+	return ExitStatus{Code: state.ExitCode()}
+}
+
+func (backend *ptyBackend) Pid() int {
+	return backend.command.Process.Pid
+}
+
+// socketBackendFactory connects to the TCP or Unix socket address given as the command.
+// It can be used to reach serial consoles and other services exposed over sockets.
+type socketBackendFactory struct {
+	network string
+}
+
+type socketBackend struct {
+	net.Conn
+	closeOnce *sync.Once
+	closed    chan bool
+}
+
+func (factory *socketBackendFactory) Start(argv []string) (Backend, error) {
+	if len(argv) != 1 {
+		return nil, errors.New("The command of the " + factory.network + " backend must be a single address")
+	}
+	conn, err := net.Dial(factory.network, argv[0])
+	if err != nil {
+		return nil, err
+	}
+	return &socketBackend{Conn: conn, closeOnce: &sync.Once{}, closed: make(chan bool)}, nil
+}
+
+func (backend *socketBackend) Resize(columns int, rows int) error {
+	return nil
+}
+
+func (backend *socketBackend) Close() error {
+	err := backend.Conn.Close()
+	backend.closeOnce.Do(func() { close(backend.closed) })
+	return err
+}
+
+func (backend *socketBackend) Wait() ExitStatus {
+	<-backend.closed
+	return ExitStatus{}
+}
+
+func (backend *socketBackend) Pid() int {
+	return 0
+}
+
+// NewFuncBackend returns a backend running the function in a goroutine,
+// to serve a REPL written in Go or to test without a process.
+// The function reads input from and writes output to the terminal,
+// and returns the exit code. The context is canceled when the backend is closed,
+// after which reading and writing the terminal fail.
+func NewFuncBackend(fn func(ctx context.Context, terminal io.ReadWriter) int) Backend {
+	ctx, cancel := context.WithCancel(context.Background())
+	inputReader, inputWriter := io.Pipe()
+	outputReader, outputWriter := io.Pipe()
+	backend := &funcBackend{
+		input:    inputWriter,
+		output:   outputReader,
+		cancel:   cancel,
+		finished: make(chan bool),
+	}
+
+	terminal := struct {
+		io.Reader
+		io.Writer
+	}{inputReader, outputWriter}
+	go func() {
+		defer close(backend.finished)
+		backend.code = fn(ctx, terminal)
+		outputWriter.Close()
+		inputReader.Close()
+	}()
+
+	return backend
+}
+
+type funcBackend struct {
+	input  *io.PipeWriter
+	output *io.PipeReader
+	cancel context.CancelFunc
+
+	// code is set before finished is closed
+	code     int
+	finished chan bool
+}
+
+func (backend *funcBackend) Read(p []byte) (int, error) {
+	return backend.output.Read(p)
+}
+
+func (backend *funcBackend) Write(p []byte) (int, error) {
+	return backend.input.Write(p)
+}
+
+func (backend *funcBackend) Resize(columns int, rows int) error {
+	return nil
+}
+
+func (backend *funcBackend) Close() error {
+	backend.cancel()
+	backend.input.Close()
+	backend.output.Close()
+	return nil
+}
+
+func (backend *funcBackend) Wait() ExitStatus {
+	<-backend.finished
+	return ExitStatus{Code: backend.code}
+}
+
+func (backend *funcBackend) Pid() int {
+	return 0
+}
@@ -4,15 +4,12 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"os/exec"
 	"strings"
 	"sync"
 	"sync/atomic"
-	"syscall"
-	"unsafe"
+	"time"
 
 	"github.com/fatih/structs"
 	"github.com/gorilla/websocket"
@@ -20,25 +17,64 @@ import (
 
 type clientContext struct {
 	app        *App
-	request    *http.Request
-	connection *websocket.Conn
-	command    *exec.Cmd
-	pty        *os.File
+	remoteAddr string
+	logger     *slog.Logger
+	user       string
+	role       string
+	route      *route
+	connection clientConnection
+	session    *session
 	writeMutex *sync.Mutex
+
+	// true when the client negotiated binaryProtocol
+	binary bool
+
+	// Messages from the session waiting to be written by writeQueued,
+	// so that a slow client doesn't hold up the others
+	queue chan []byte
+	// Closed when the client is detached from the session
+	detached chan bool
 }
 
+// Messages from the session queued for each client
+const clientQueueSize = 64
+
+// Time to wait for a client with a full queue before disconnecting it
+var clientSendTimeout = 10 * time.Second
+
+// clientConnection carries the messages of a client,
+// a websocket connection or an SSH channel translating them.
+type clientConnection interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+const (
+	// Messages are text frames and output is base64 encoded
+	textProtocol = "gotty"
+	// Messages are binary frames and output is sent as is
+	binaryProtocol = "gotty.binary"
+)
+
 const (
 	Input          = '0'
 	Ping           = '1'
 	ResizeTerminal = '2'
+	ReplayControl  = '3'
 )
 
 const (
-	Output         = '0'
-	Pong           = '1'
-	SetWindowTitle = '2'
-	SetPreferences = '3'
-	SetReconnect   = '4'
+	Output          = '0'
+	Pong            = '1'
+	SetWindowTitle  = '2'
+	SetPreferences  = '3'
+	SetReconnect    = '4'
+	SetReplayStatus = '5'
+	SetSessionID    = '6'
+	ShowMessage     = '7'
+	SetExitStatus   = '8'
+	SetTerminalSize = '9'
 )
 
 type argResizeTerminal struct {
@@ -51,70 +87,106 @@ type ContextVars struct {
 	Pid        int
 	Hostname   string
 	RemoteAddr string
+	User       string
+	Role       string
 }
 
 func (context *clientContext) goHandleClient() {
-	exit := make(chan bool, 2)
-
-	go func() {
-		defer func() { exit <- true }()
-
-		context.processSend()
-	}()
-
-	go func() {
-		defer func() { exit <- true }()
-
-		context.processReceive()
-	}()
-
 	go func() {
-		defer context.app.server.FinishRoutine()
+		defer context.app.finishRoutine()
 		defer func() {
 			connections := atomic.AddInt64(context.app.connections, -1)
 
-			if context.app.options.MaxConnection != 0 {
-				log.Printf("Connection closed: %s, connections: %d/%d",
-					context.request.RemoteAddr, connections, context.app.options.MaxConnection)
-			} else {
-				log.Printf("Connection closed: %s, connections: %d",
-					context.request.RemoteAddr, connections)
-			}
+			context.logger.Info("Connection closed", "connections", connections)
 
 			if connections == 0 {
 				context.app.restartTimer()
 			}
 		}()
 
-		<-exit
-		context.pty.Close()
-
-		// Even if the PTY has been closed,
-		// Read(0 in processSend() keeps blocking and the process doen't exit
-		context.command.Process.Signal(syscall.Signal(context.app.options.CloseSignal))
+		if err := context.sendInitialize(); err != nil {
+			context.logger.Warn("Failed to initialize client", "error", err)
+		} else if context.session.attach(context) {
+			context.processReceive()
+			context.session.detach(context)
+		} else {
+			// The command exited before the client attached
+			exit, _ := json.Marshal(context.session.exit)
+			if err := context.write(append([]byte{SetExitStatus}, exit...)); err != nil {
+				context.logger.Warn("Failed to send exit status", "error", err)
+			}
+		}
 
-		context.command.Wait()
+		if !context.app.options.Shared {
+			if grace := context.app.options.SessionGracePeriod; grace > 0 {
+				context.session.closeWhenIdle(time.Duration(grace) * time.Second)
+			} else {
+				context.session.close("client disconnected")
+			}
+		}
 		context.connection.Close()
 	}()
 }
 
-func (context *clientContext) processSend() {
-	if err := context.sendInitialize(); err != nil {
-		log.Printf(err.Error())
+func (context *clientContext) sendOutput(data []byte) error {
+	return context.write(context.outputMessage(data))
+}
+
+func (context *clientContext) outputMessage(data []byte) []byte {
+	if context.binary {
+		return append([]byte{Output}, data...)
+	}
+	safeMessage := base64.StdEncoding.EncodeToString(data)
+	return append([]byte{Output}, []byte(safeMessage)...)
+}
+
+// startQueue starts writing the messages queued by queueMessage until the client is detached.
+func (context *clientContext) startQueue() {
+	context.queue = make(chan []byte, clientQueueSize)
+	context.detached = make(chan bool)
+	go context.writeQueued()
+}
+
+// queueMessage queues a message from the session for the client.
+// When the queue is full, it waits for the client to catch up for clientSendTimeout
+// and disconnects the client after that.
+// A nil message closes the connection once the messages queued before are written.
+func (context *clientContext) queueMessage(message []byte) {
+	select {
+	case context.queue <- message:
 		return
+	case <-context.detached:
+		return
+	default:
 	}
 
-	buf := make([]byte, 1024)
+	timer := time.NewTimer(clientSendTimeout)
+	defer timer.Stop()
+	select {
+	case context.queue <- message:
+	case <-context.detached:
+	case <-timer.C:
+		context.logger.Warn("Client is too slow to receive output, disconnecting")
+		// Closing an SSH channel can block on the stalled connection
+		go context.connection.Close()
+	}
+}
 
+// writeQueued writes the queued messages until the client is detached or fails.
+func (context *clientContext) writeQueued() {
 	for {
-		size, err := context.pty.Read(buf)
-		if err != nil {
-			log.Printf("Command exited for: %s", context.request.RemoteAddr)
-			return
-		}
-		safeMessage := base64.StdEncoding.EncodeToString([]byte(buf[:size]))
-		if err = context.write(append([]byte{Output}, []byte(safeMessage)...)); err != nil {
-			log.Printf(err.Error())
+		select {
+		case message := <-context.queue:
+			if message == nil {
+				context.connection.Close()
+				return
+			}
+			if err := context.write(message); err != nil {
+				context.logger.Warn("Failed to send output", "error", err)
+				context.connection.Close()
+				return
+			}
+		case <-context.detached:
 			return
 		}
 	}
@@ -123,35 +195,38 @@ func (context *clientContext) processSend() {
 func (context *clientContext) write(data []byte) error {
 	context.writeMutex.Lock()
 	defer context.writeMutex.Unlock()
+	if context.binary {
+		return context.connection.WriteMessage(websocket.BinaryMessage, data)
+	}
 	return context.connection.WriteMessage(websocket.TextMessage, data)
 }
 
 func (context *clientContext) sendInitialize() error {
 	hostname, _ := os.Hostname()
+	command := context.app.command
+	pid := 0
+	if context.session != nil {
+		command = context.session.argv
+		pid = context.session.pid()
+	}
 	titleVars := ContextVars{
-		Command:    strings.Join(context.app.command, " "),
-		Pid:        context.command.Process.Pid,
+		Command:    strings.Join(command, " "),
+		Pid:        pid,
 		Hostname:   hostname,
-		RemoteAddr: context.request.RemoteAddr,
+		RemoteAddr: context.remoteAddr,
+		User:       context.user,
+		Role:       context.role,
 	}
 
+	titleTemplate, htermPrefs := context.app.clientSettings(context.route)
 	titleBuffer := new(bytes.Buffer)
-	if err := context.app.titleTemplate.Execute(titleBuffer, titleVars); err != nil {
+	if err := titleTemplate.Execute(titleBuffer, titleVars); err != nil {
 		return err
 	}
 	if err := context.write(append([]byte{SetWindowTitle}, titleBuffer.Bytes()...)); err != nil {
 		return err
 	}
 
-	prefStruct := structs.New(context.app.options.Preferences)
-	prefMap := prefStruct.Map()
-	htermPrefs := make(map[string]interface{})
-	for key, value := range prefMap {
-		rawKey := prefStruct.Field(key).Tag("hcl")
-		if _, ok := context.app.options.RawPreferences[rawKey]; ok {
-			htermPrefs[strings.Replace(rawKey, "_", "-", -1)] = value
-		}
-	}
 	prefs, err := json.Marshal(htermPrefs)
 	if err != nil {
 		return err
@@ -160,6 +235,11 @@ func (context *clientContext) sendInitialize() error {
 	if err := context.write(append([]byte{SetPreferences}, prefs...)); err != nil {
 		return err
 	}
+	if context.session != nil && context.app.options.SessionGracePeriod > 0 {
+		if err := context.write(append([]byte{SetSessionID}, context.session.id...)); err != nil {
+			return err
+		}
+	}
 	if context.app.options.EnableReconnect {
 		reconnect, _ := json.Marshal(context.app.options.ReconnectTime)
 		if err := context.write(append([]byte{SetReconnect}, reconnect...)); err != nil {
@@ -169,72 +249,75 @@ func (context *clientContext) sendInitialize() error {
 	return nil
 }
 
+// htermPreferences returns the preferences set in the config file with keys for hterm.
+func htermPreferences(preferences HtermPrefernces, rawPreferences map[string]interface{}) map[string]interface{} {
+	prefStruct := structs.New(preferences)
+	prefMap := prefStruct.Map()
+	htermPrefs := make(map[string]interface{})
+	for key, value := range prefMap {
+		rawKey := prefStruct.Field(key).Tag("hcl")
+		if _, ok := rawPreferences[rawKey]; ok {
+			htermPrefs[strings.Replace(rawKey, "_", "-", -1)] = value
+		}
+	}
+	return htermPrefs
+}
+
 func (context *clientContext) processReceive() {
 	for {
 		_, data, err := context.connection.ReadMessage()
 		if err != nil {
-			log.Print(err.Error())
+			context.logger.Info("Client disconnected", "reason", err)
 			return
 		}
 		if len(data) == 0 {
-			log.Print("An error has occured")
+			context.logger.Warn("Received an empty message")
 			return
 		}
 
 		switch data[0] {
 		case Input:
-			if !context.app.options.PermitWrite {
+			if context.role != roleOperator {
 				break
 			}
 
-			_, err := context.pty.Write(data[1:])
-			if err != nil {
+			if err := context.session.write(data[1:]); err != nil {
 				return
 			}
 
 		case Ping:
 			if err := context.write([]byte{Pong}); err != nil {
-				log.Print(err.Error())
+				context.logger.Warn("Failed to send pong", "error", err)
 				return
 			}
 		case ResizeTerminal:
 			var args argResizeTerminal
 			err = json.Unmarshal(data[1:], &args)
 			if err != nil {
-				log.Print("Malformed remote command")
+				context.logger.Warn("Malformed remote command", "error", err)
 				return
 			}
 
+			// Viewers watching a shared process don't change the size for everyone
+			if context.role != roleOperator && context.app.options.Shared {
+				break
+			}
+
 			rows := uint16(context.app.options.Height)
 			if rows == 0 {
-				rows = uint16(args.Rows)
+				rows = uint16(clamp(int(args.Rows), 0, maxTerminalSize))
 			}
 
 			columns := uint16(context.app.options.Width)
 			if columns == 0 {
-				columns = uint16(args.Columns)
+				columns = uint16(clamp(int(args.Columns), 0, maxTerminalSize))
 			}
 
-			window := struct {
-				row uint16
-				col uint16
-				x   uint16
-				y   uint16
-			}{
-				rows,
-				columns,
-				0,
-				0,
-			}
-			syscall.Syscall(
-				syscall.SYS_IOCTL,
-				context.pty.Fd(),
-				syscall.TIOCSWINSZ,
-				uintptr(unsafe.Pointer(&window)),
-			)
+			context.logger.Debug("Resizing terminal", "columns", columns, "rows", rows)
+			context.session.resize(columns, rows)
 
 		default:
-			log.Print("Unknown message type")
+			context.logger.Warn("Unknown message type", "type", string(data[0]))
 			return
 		}
 	}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stalledConnection never finishes writing until it is closed.
+type stalledConnection struct {
+	closeOnce *sync.Once
+	closed    chan bool
+}
+
+func (connection *stalledConnection) ReadMessage() (int, []byte, error) {
+	<-connection.closed
+	return 0, nil, io.EOF
+}
+
+func (connection *stalledConnection) WriteMessage(messageType int, data []byte) error {
+	<-connection.closed
+	return io.EOF
+}
+
+func (connection *stalledConnection) Close() error {
+	connection.closeOnce.Do(func() { close(connection.closed) })
+	return nil
+}
+
+func TestClientQueue(t *testing.T) {
+	timeout := clientSendTimeout
+	clientSendTimeout = 100 * time.Millisecond
+	defer func() { clientSendTimeout = timeout }()
+
+	connection := &stalledConnection{closeOnce: &sync.Once{}, closed: make(chan bool)}
+	context := &clientContext{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		connection: connection,
+		writeMutex: &sync.Mutex{},
+		binary:     true,
+	}
+	context.startQueue()
+	defer close(context.detached)
+
+	// One message is being written, the others fill the queue without waiting
+	start := time.Now()
+	for i := 0; i < clientQueueSize+1; i++ {
+		context.queueMessage(context.outputMessage([]byte("output")))
+	}
+	if elapsed := time.Since(start); elapsed >= clientSendTimeout {
+		t.Fatalf("expected the messages to be queued without waiting, took %s", elapsed)
+	}
+	select {
+	case <-connection.closed:
+		t.Fatal("expected the client to be connected while its queue has room")
+	default:
+	}
+
+	context.queueMessage(context.outputMessage([]byte("overflow")))
+	select {
+	case <-connection.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the client to be disconnected when its queue stays full")
+	}
+}
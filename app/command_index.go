@@ -0,0 +1,59 @@
+package app
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+var commandIndexTemplate = template.Must(template.New("index").Parse(`<!doctype html>
+<html>
+  <head>
+    <title>GoTTY</title>
+    <style>
+      body {margin: 40px; background: rgb(16, 16, 16); color: rgb(240, 240, 240); font: 14px monospace;}
+      a {color: rgb(120, 190, 255); font-size: 16px;}
+      li {margin-bottom: 12px;}
+      .command {color: rgb(160, 160, 160);}
+    </style>
+    <link rel="icon" type="image/png" href="favicon.png">
+  </head>
+  <body>
+    <h1>GoTTY</h1>
+    <ul>
+      {{range .}}<li><a href="{{.Link}}">{{.Name}}</a><br><span class="command">{{.Command}}</span></li>
+      {{end}}
+    </ul>
+  </body>
+</html>
+`))
+
+type commandIndexEntry struct {
+	Name    string
+	Link    string
+	Command string
+}
+
+// commandIndexHandler lists the commands served under path,
+// used when no command is given on the command line.
+func (app *App) commandIndexHandler(path string) http.Handler {
+	entries := []commandIndexEntry{}
+	for _, route := range app.routes {
+		entries = append(entries, commandIndexEntry{
+			Name:    route.name,
+			Link:    strings.TrimPrefix(route.path, "/"),
+			Command: strings.Join(route.command, " "),
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path+"/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := commandIndexTemplate.Execute(w, entries); err != nil {
+			requestLogger(r).Error("Failed to render command index", "error", err)
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/yudai/hcl"
+	hclobj "github.com/yudai/hcl/hcl"
+)
+
+// Shown in place of passwords and secrets by FormatConfig
+const redacted = "********"
+
+// CheckConfigFile returns the problems of the config file: options which don't exist,
+// which are silently ignored when the file is loaded, values of wrong types
+// and invalid combinations of options.
+// The file is checked alone, without the defaults of the options given on the command line.
+func CheckConfigFile(filePath string) []error {
+	fileString, err := ioutil.ReadFile(ExpandHomeDir(filePath))
+	if err != nil {
+		return []error{err}
+	}
+	object, err := hcl.Parse(string(fileString))
+	if err != nil {
+		return []error{err}
+	}
+
+	problems := []error{}
+	for _, unknown := range unknownOptions("", object, reflect.TypeOf(Options{})) {
+		problems = append(problems, errors.New(unknown))
+	}
+
+	// Options are decoded one by one to report all the invalid values
+	options := DefaultOptions
+	occurrences := make(map[string]int)
+	for _, child := range object.Elem(true) {
+		key := strings.ToLower(child.Key)
+		occurrences[key]++
+		single := &hclobj.Object{Type: hclobj.ValueTypeObject, Value: []*hclobj.Object{child}}
+		if err := hcl.DecodeObject(&options, single); err != nil {
+			message := strings.TrimPrefix(strings.TrimPrefix(err.Error(), "root."+child.Key+": "), "root.")
+			if line := optionLine(string(fileString), child.Key, occurrences[key]); line > 0 {
+				problems = append(problems, fmt.Errorf("Invalid value of %s at line %d: %s", child.Key, line, message))
+			} else {
+				problems = append(problems, fmt.Errorf("Invalid value of %s: %s", child.Key, message))
+			}
+		}
+	}
+	if options.Credential != "" && !options.EnableBasicAuth {
+		problems = append(problems, errors.New("credential is ignored unless enable_basic_auth is true"))
+	}
+	if err := CheckConfig(&options); err != nil {
+		problems = append(problems, err)
+	}
+	return problems
+}
+
+// optionLine returns the line of the nth option of the name at the top level of the config file,
+// in HCL or JSON, or 0 when it's not found. The parser doesn't keep the positions.
+func optionLine(config string, name string, nth int) int {
+	pattern := regexp.MustCompile(`(?i)^\s*"?` + regexp.QuoteMeta(name) + `"?\s*[=:{"]`)
+	for i, line := range strings.Split(config, "\n") {
+		if pattern.MatchString(line) {
+			nth--
+			if nth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// unknownOptions returns a message for each key in the object which is not an option
+// of the type, a struct or a map of structs for named blocks.
+func unknownOptions(path string, object *hclobj.Object, t reflect.Type) []string {
+	unknown := []string{}
+	if object.Type != hclobj.ValueTypeObject {
+		// Not a block, the decoder reports the type error
+		return unknown
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		if t.Elem().Kind() != reflect.Struct {
+			return unknown
+		}
+		for _, block := range object.Elem(true) {
+			unknown = append(unknown, unknownOptions(path+block.Key+".", block, t.Elem())...)
+		}
+
+	case reflect.Struct:
+		for _, child := range object.Elem(true) {
+			field, ok := optionField(t, child.Key)
+			if !ok {
+				message := "Unknown option " + path + child.Key
+				if suggestion := suggestOption(t, child.Key); suggestion != "" {
+					message += ", did you mean " + path + suggestion + "?"
+				}
+				unknown = append(unknown, message)
+				continue
+			}
+			for _, value := range child.Elem(false) {
+				unknown = append(unknown, unknownOptions(path+child.Key+".", value, field.Type)...)
+			}
+		}
+	}
+	return unknown
+}
+
+// optionField returns the field of the option named like the decoder does, ignoring case.
+// Preferences are matched to the struct rather than the raw map of the same name.
+func optionField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if strings.EqualFold(field.Tag.Get("hcl"), name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// suggestOption returns the option of the type closest to the misspelled name,
+// or an empty string when none is close enough.
+func suggestOption(t reflect.Type, name string) string {
+	name = strings.ToLower(name)
+	suggestion, best := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		option := t.Field(i).Tag.Get("hcl")
+		if distance := editDistance(name, option); distance < best {
+			suggestion, best = option, distance
+		}
+	}
+	return suggestion
+}
+
+// editDistance returns the Levenshtein distance between the strings.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// FormatConfig returns the options as a JSON config file, which GoTTY can load as well,
+// with passwords and secrets redacted.
+// Only the preferences set in the config file are included.
+func FormatConfig(options *Options) ([]byte, error) {
+	shown := *options
+	shown.Credential = redactCredential(shown.Credential)
+	shown.AdminCredential = redactCredential(shown.AdminCredential)
+	if shown.OIDCClientSecret != "" {
+		shown.OIDCClientSecret = redacted
+	}
+	if shown.SSHPassword != "" {
+		shown.SSHPassword = redacted
+	}
+
+	return json.MarshalIndent(configValue(reflect.ValueOf(shown)), "", "  ")
+}
+
+// redactCredential hides the password of "user:pass" and keeps the user.
+func redactCredential(credential string) string {
+	if credential == "" {
+		return ""
+	}
+	if i := strings.Index(credential, ":"); i >= 0 {
+		return credential[:i+1] + redacted
+	}
+	return redacted
+}
+
+// configValue converts the options to values keyed by their names in the config file.
+// Unset pointers are left out.
+func configValue(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
+		return configValue(value.Elem())
+
+	case reflect.Map:
+		if value.Type().Elem().Kind() != reflect.Struct {
+			return value.Interface()
+		}
+		blocks := map[string]interface{}{}
+		for _, key := range value.MapKeys() {
+			blocks[fmt.Sprint(key.Interface())] = configValue(value.MapIndex(key))
+		}
+		return blocks
+
+	case reflect.Struct:
+		values := map[string]interface{}{}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			name := field.Tag.Get("hcl")
+			if name == "" || field.Name == "RawPreferences" {
+				continue
+			}
+			if field.Type.Kind() == reflect.Ptr && value.Field(i).IsNil() {
+				continue
+			}
+			if field.Name == "Preferences" {
+				preferences := setPreferences(value.Field(i), value.FieldByName("RawPreferences"))
+				if len(preferences) > 0 {
+					values[name] = preferences
+				}
+				continue
+			}
+			values[name] = configValue(value.Field(i))
+		}
+		return values
+
+	default:
+		return value.Interface()
+	}
+}
+
+// setPreferences returns the preferences which are set in the config file.
+func setPreferences(preferences reflect.Value, rawPreferences reflect.Value) map[string]interface{} {
+	values := map[string]interface{}{}
+	for i := 0; i < preferences.NumField(); i++ {
+		name := preferences.Type().Field(i).Tag.Get("hcl")
+		if rawPreferences.MapIndex(reflect.ValueOf(name)).IsValid() {
+			values[name] = configValue(preferences.Field(i))
+		}
+	}
+	return values
+}
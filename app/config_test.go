@@ -0,0 +1,137 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "gotty.conf")
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	cases := map[string]struct {
+		config   string
+		problems []string
+	}{
+		"valid": {`
+port = "9000"
+permit_write = true
+preferences {
+	font_size = 12
+}
+command "top" {
+	command = ["top"]
+}
+`, []string{}},
+		"unknown options": {`
+prot = "9000"
+completely_unknown = true
+preferences {
+	font_sise = 12
+}
+command "top" {
+	command = ["top"]
+	titel_format = "top"
+}
+`, []string{
+			"Unknown option prot, did you mean port?",
+			"Unknown option completely_unknown",
+			"Unknown option preferences.font_sise, did you mean preferences.font_size?",
+			"Unknown option command.top.titel_format, did you mean command.top.title_format?",
+		}},
+		"type": {`
+port = "9000"
+max_connection = "many"
+shared = "yes"
+`, []string{"Invalid value of max_connection at line 3: ", "Invalid value of shared at line 4: "}},
+		"type in json": {`{
+  "port": "9000",
+  "max_connection": "many"
+}`, []string{"Invalid value of max_connection at line 3: "}},
+		"credential": {`credential = "alice:secret"`, []string{"credential is ignored unless enable_basic_auth is true"}},
+		"combination": {`
+enable_basic_auth = true
+credential = "alice:secret"
+oidc_issuer = "https://accounts.example.com"
+oidc_client_id = "gotty"
+`, []string{"can't be enabled at the same time"}},
+		"syntax": {`port = `, []string{""}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			problems := CheckConfigFile(writeConfigFile(t, c.config))
+			if len(problems) != len(c.problems) {
+				t.Fatalf("expected %d problems, got %v", len(c.problems), problems)
+			}
+			for i, problem := range problems {
+				if !strings.Contains(problem.Error(), c.problems[i]) {
+					t.Errorf("expected a problem like %q, got %q", c.problems[i], problem)
+				}
+			}
+		})
+	}
+
+	if problems := CheckConfigFile(filepath.Join(t.TempDir(), "missing")); len(problems) != 1 {
+		t.Fatalf("expected a missing file to be reported, got %v", problems)
+	}
+}
+
+func TestFormatConfig(t *testing.T) {
+	options := DefaultOptions
+	options.Credential = "alice:s3cr3t"
+	options.AdminCredential = "s3cr3t"
+	options.OIDCClientSecret = "s3cr3t"
+	options.Port = "9000"
+	options.RawPreferences = map[string]interface{}{"font_size": 12}
+	options.Preferences.FontSize = 12
+
+	formatted, err := FormatConfig(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(formatted), "s3cr3t") {
+		t.Fatalf("expected the secrets to be redacted, got %s", formatted)
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(formatted, &values); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"credential":         "alice:" + redacted,
+		"admin_credential":   redacted,
+		"oidc_client_secret": redacted,
+		"port":               "9000",
+		"preferences":        map[string]interface{}{"font_size": float64(12)},
+	}
+	for name, value := range expected {
+		if formatted, _ := json.Marshal(values[name]); string(formatted) != mustMarshal(t, value) {
+			t.Errorf("expected %s to be %s, got %s", name, mustMarshal(t, value), formatted)
+		}
+	}
+
+	// The output can be loaded as a config file
+	loaded := DefaultOptions
+	if _, err := ApplyConfigFile(&loaded, writeConfigFile(t, string(formatted))); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Port != "9000" || loaded.Preferences.FontSize != 12 {
+		t.Fatalf("unexpected options loaded %+v", loaded)
+	}
+}
+
+func mustMarshal(t *testing.T, value interface{}) string {
+	marshaled, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(marshaled)
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Connection tokens are fetched right before opening a websocket,
+// so they don't need to live long.
+const connectionTokenLifetime = 30 * time.Second
+
+// connectionTokens issues signed single use tokens to clients which have passed
+// HTTP authentication, so that websocket connections can be authenticated
+// without sending the credential itself.
+type connectionTokens struct {
+	// Key to sign tokens, regenerated on every start
+	key []byte
+
+	mutex *sync.Mutex
+	// Nonces of redeemed tokens and when they expire
+	redeemed map[string]int64
+}
+
+type connectionToken struct {
+	Nonce   string
+	User    string
+	Expires int64
+}
+
+func newConnectionTokens() (*connectionTokens, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &connectionTokens{
+		key:      key,
+		mutex:    &sync.Mutex{},
+		redeemed: make(map[string]int64),
+	}, nil
+}
+
+func (tokens *connectionTokens) issue(user string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return signValue(tokens.key, purposeConnectionToken, connectionToken{
+		Nonce:   base64.RawURLEncoding.EncodeToString(nonce),
+		User:    user,
+		Expires: time.Now().Add(connectionTokenLifetime).Unix(),
+	})
+}
+
+// redeem returns the user the token is issued for.
+// A token is accepted only once and only until it expires.
+func (tokens *connectionTokens) redeem(value string) (string, bool) {
+	var token connectionToken
+	if !verifySignedValue(tokens.key, purposeConnectionToken, value, &token) {
+		return "", false
+	}
+
+	now := time.Now().Unix()
+	if now > token.Expires {
+		return "", false
+	}
+
+	tokens.mutex.Lock()
+	defer tokens.mutex.Unlock()
+
+	for nonce, expires := range tokens.redeemed {
+		if now > expires {
+			delete(tokens.redeemed, nonce)
+		}
+	}
+	if _, ok := tokens.redeemed[token.Nonce]; ok {
+		return "", false
+	}
+	tokens.redeemed[token.Nonce] = token.Expires
+
+	return token.User, true
+}
+
+// Purposes of signed values, so that a value signed for one purpose,
+// like the state of a login, is not accepted for another one, like a session
+const (
+	purposeConnectionToken = "connection_token"
+	purposeOIDCState       = "oidc_state"
+	purposeOIDCSession     = "oidc_session"
+)
+
+// signValue encodes v as JSON and appends an HMAC-SHA256 signature of it and the purpose.
+func signValue(key []byte, purpose string, v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature(key, purpose, encoded)), nil
+}
+
+// verifySignedValue decodes a value created by signValue for the purpose into v
+// and returns false when the signature doesn't match or the value is not of the type of v.
+func verifySignedValue(key []byte, purpose string, value string, v interface{}) bool {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	if !hmac.Equal(mac, signature(key, purpose, parts[0])) {
+		return false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v) == nil
+}
+
+func signature(key []byte, purpose string, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose + ":" + encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectionTokens(t *testing.T) {
+	tokens, err := newConnectionTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := tokens.issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, ok := tokens.redeem(token); !ok || user != "alice" {
+		t.Fatalf("expected the token to be redeemed for alice, got %q %v", user, ok)
+	}
+	if _, ok := tokens.redeem(token); ok {
+		t.Fatal("expected the token to be accepted only once")
+	}
+
+	other, err := tokens.issue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, ok := tokens.redeem(other); !ok || user != "" {
+		t.Fatalf("expected the token to be redeemed for no user, got %q %v", user, ok)
+	}
+}
+
+func TestConnectionTokensRejected(t *testing.T) {
+	tokens, err := newConnectionTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	others, err := newConnectionTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := tokens.issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	forged, err := signValue([]byte("forged"), purposeConnectionToken, connectionToken{Nonce: "n", User: "alice", Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := signValue(tokens.key, purposeConnectionToken, connectionToken{Nonce: "n", User: "alice", Expires: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"tampered payload": "e30." + parts[1],
+		"no signature":     parts[0],
+		"forged":           forged,
+		"expired":          expired,
+		"empty":            "",
+	}
+	for name, value := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := tokens.redeem(value); ok {
+				t.Fatal("expected the token to be rejected")
+			}
+		})
+	}
+	if _, ok := others.redeem(token); ok {
+		t.Fatal("expected a token of another server to be rejected")
+	}
+}
+
+func TestAuthTokenScript(t *testing.T) {
+	options := DefaultOptions
+	options.EnableBasicAuth = true
+	options.Credential = "alice:secret"
+	server, _ := newTestServer(t, options, nil, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "authenticated")
+		<-ctx.Done()
+		return 0
+	}))
+
+	response, err := http.Get(server.URL + "/auth_token.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the script to require authentication, got %d", response.StatusCode)
+	}
+
+	request, _ := http.NewRequest("GET", server.URL+"/auth_token.js", nil)
+	request.SetBasicAuth("alice", "secret")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/javascript" {
+		t.Fatalf("expected a script, got %q", contentType)
+	}
+	match := regexp.MustCompile(`^var gotty_auth_token = ("[^"]+");$`).FindSubmatch(script)
+	if match == nil {
+		t.Fatalf("expected the token in gotty_auth_token, got %q", script)
+	}
+	var token string
+	json.Unmarshal(match[1], &token)
+
+	dialer := websocket.Dialer{Subprotocols: []string{binaryProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	init, _ := json.Marshal(InitMessage{AuthToken: token})
+	conn.WriteMessage(websocket.TextMessage, init)
+	readMessage(t, conn, Output, "authenticated")
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Callbacks are called on the lifecycle events of sessions
+// from goroutines serving clients. Any of them can be nil.
+type Callbacks struct {
+	// Called when a command has started for a client
+	OnSessionStart func(session SessionInfo)
+	// Called when a command has exited or has been closed,
+	// with its exit code, 128+N when killed by signal N
+	OnSessionEnd func(session SessionInfo, exitCode int)
+	// Called when a command fails to start for a client
+	OnError func(err error)
+}
+
+// SessionInfo describes a command started for a client.
+type SessionInfo struct {
+	ID        string
+	PID       int
+	Argv      []string
+	User      string
+	StartTime time.Time
+}
+
+// NewHandler returns a handler serving the command with the options,
+// to mount GoTTY in another server:
+//
+//	handler, err := app.NewHandler(ctx, []string{"top"}, &options, nil)
+//	mux.Handle("/terminal/", http.StripPrefix("/terminal", handler))
+//
+// When the context is done, running commands are closed and new clients are rejected.
+// The options to listen, Address, Port, the TLS options and EnableRandomUrl, are ignored,
+// and Once and Timeout, which stop the server, are not available.
+// OpenID Connect requires OIDCRedirectURL, the external URL of the callback,
+// from which the path the handler is mounted at is taken.
+func NewHandler(ctx context.Context, command []string, options *Options, callbacks *Callbacks) (http.Handler, error) {
+	if err := CheckConfig(options); err != nil {
+		return nil, err
+	}
+	if options.Once || options.Timeout > 0 {
+		return nil, errors.New("Once and Timeout options are not available for handlers")
+	}
+	if options.OIDCIssuer != "" && options.OIDCRedirectURL == "" {
+		return nil, errors.New("OpenID Connect requires the OIDCRedirectURL option for handlers")
+	}
+
+	app, err := New(command, options)
+	if err != nil {
+		return nil, err
+	}
+	if callbacks != nil {
+		app.callbacks = *callbacks
+	}
+
+	app.logOptions()
+	handler := app.handler("")
+
+	go func() {
+		<-ctx.Done()
+		app.closeSessions("context done")
+	}()
+
+	return handler, nil
+}
+
+// closeSessions closes the running sessions and prevents new ones from starting.
+// Sessions are closed outside the lock, as closing waits for the backends.
+func (app *App) closeSessions(reason string) {
+	app.sessionMutex.Lock()
+	app.sessionsClosed = true
+	sessions := make([]*session, 0, len(app.sessions))
+	for _, session := range app.sessions {
+		sessions = append(sessions, session)
+	}
+	app.sessionMutex.Unlock()
+
+	for _, session := range sessions {
+		session.close(reason)
+	}
+}
+
+func (app *App) closing() bool {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+	return app.sessionsClosed
+}
+
+// startRoutine and finishRoutine track clients for the server of Run to wait for them
+// before exiting.
+func (app *App) startRoutine() {
+	if app.server != nil {
+		app.server.StartRoutine()
+	}
+}
+
+func (app *App) finishRoutine() {
+	if app.server != nil {
+		app.server.FinishRoutine()
+	}
+}
+
+func (session *session) info() SessionInfo {
+	return SessionInfo{
+		ID:        session.id,
+		PID:       session.pid(),
+		Argv:      session.argv,
+		User:      session.user,
+		StartTime: session.startTime,
+	}
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// NewLogger returns a logger writing in the format given by the LogFormat option,
+// "text" or "json", dropping records below the LogLevel option.
+func NewLogger(w io.Writer, options *Options) (*slog.Logger, error) {
+	level, err := parseLogLevel(options.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	handlerOptions := &slog.HandlerOptions{Level: level}
+
+	switch options.LogFormat {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, handlerOptions)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, handlerOptions)), nil
+	default:
+		return nil, errors.New("Unknown log format " + options.LogFormat + ", must be text or json")
+	}
+}
+
+func parseLogLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, errors.New("Unknown log level " + name + ", must be debug, info, warn or error")
+	}
+}
+
+type requestLoggerKey struct{}
+
+// requestLogger returns the logger of the request with its ID set by wrapLogger.
+func requestLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(requestLoggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func withRequestLogger(r *http.Request, logger *slog.Logger) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestLoggerKey{}, logger))
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds of the buckets of the session duration histogram in seconds
+var sessionDurationBuckets = []float64{60, 300, 900, 3600, 4 * 3600, 12 * 3600, 24 * 3600}
+
+// metrics counts what happens on the server to be exported to Prometheus.
+type metrics struct {
+	mutex *sync.Mutex
+
+	sessions int64
+	// Connections rejected by the reason
+	rejected map[string]int64
+	bytesIn  int64
+	bytesOut int64
+
+	// Cumulative counts of sessions closed within each of sessionDurationBuckets
+	durationBuckets []int64
+	durationCount   int64
+	durationSum     float64
+
+	exitCodes map[int]int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		mutex:           &sync.Mutex{},
+		rejected:        make(map[string]int64),
+		durationBuckets: make([]int64, len(sessionDurationBuckets)),
+		exitCodes:       make(map[int]int64),
+	}
+}
+
+func (metrics *metrics) sessionStarted() {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.sessions++
+}
+
+func (metrics *metrics) sessionClosed(duration time.Duration, exitCode int) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	seconds := duration.Seconds()
+	for i, bound := range sessionDurationBuckets {
+		if seconds <= bound {
+			metrics.durationBuckets[i]++
+		}
+	}
+	metrics.durationCount++
+	metrics.durationSum += seconds
+	metrics.exitCodes[exitCode]++
+}
+
+func (metrics *metrics) connectionRejected(reason string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.rejected[reason]++
+}
+
+func (metrics *metrics) transferred(in int, out int) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.bytesIn += int64(in)
+	metrics.bytesOut += int64(out)
+}
+
+// write writes the metrics in the Prometheus text format.
+func (metrics *metrics) write(buffer *bytes.Buffer, connections int64, activeSessions int) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	writeMetricHeader(buffer, "gotty_connections", "gauge", "Websocket connections currently open.")
+	fmt.Fprintf(buffer, "gotty_connections %d\n", connections)
+
+	writeMetricHeader(buffer, "gotty_sessions", "gauge", "Processes currently running.")
+	fmt.Fprintf(buffer, "gotty_sessions %d\n", activeSessions)
+
+	writeMetricHeader(buffer, "gotty_sessions_total", "counter", "Processes started.")
+	fmt.Fprintf(buffer, "gotty_sessions_total %d\n", metrics.sessions)
+
+	writeMetricHeader(buffer, "gotty_rejected_connections_total", "counter", "Connections rejected by the reason, auth for failed authentications.")
+	reasons := make([]string, 0, len(metrics.rejected))
+	for reason := range metrics.rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(buffer, "gotty_rejected_connections_total{reason=%q} %d\n", reason, metrics.rejected[reason])
+	}
+
+	writeMetricHeader(buffer, "gotty_transferred_bytes_total", "counter", "Bytes written to (in) and read from (out) the PTYs.")
+	fmt.Fprintf(buffer, "gotty_transferred_bytes_total{direction=\"in\"} %d\n", metrics.bytesIn)
+	fmt.Fprintf(buffer, "gotty_transferred_bytes_total{direction=\"out\"} %d\n", metrics.bytesOut)
+
+	writeMetricHeader(buffer, "gotty_session_duration_seconds", "histogram", "Lifetime of closed processes.")
+	for i, bound := range sessionDurationBuckets {
+		fmt.Fprintf(buffer, "gotty_session_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), metrics.durationBuckets[i])
+	}
+	fmt.Fprintf(buffer, "gotty_session_duration_seconds_bucket{le=\"+Inf\"} %d\n", metrics.durationCount)
+	fmt.Fprintf(buffer, "gotty_session_duration_seconds_sum %s\n", strconv.FormatFloat(metrics.durationSum, 'g', -1, 64))
+	fmt.Fprintf(buffer, "gotty_session_duration_seconds_count %d\n", metrics.durationCount)
+
+	writeMetricHeader(buffer, "gotty_command_exits_total", "counter", "Processes exited by the exit code, 128+N when killed by signal N.")
+	codes := make([]int, 0, len(metrics.exitCodes))
+	for code := range metrics.exitCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(buffer, "gotty_command_exits_total{code=\"%d\"} %d\n", code, metrics.exitCodes[code])
+	}
+}
+
+func writeMetricHeader(buffer *bytes.Buffer, name string, kind string, help string) {
+	fmt.Fprintf(buffer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (app *App) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var buffer bytes.Buffer
+	app.metrics.write(&buffer, atomic.LoadInt64(app.connections), len(app.runningSessions()))
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buffer.Bytes())
+}
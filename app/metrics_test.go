@@ -0,0 +1,108 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := newMetrics()
+	metrics.sessionStarted()
+	metrics.sessionStarted()
+	metrics.sessionStarted()
+	metrics.sessionClosed(30*time.Second, 0)
+	metrics.sessionClosed(2*time.Hour, 130)
+	metrics.connectionRejected("max_connection")
+	metrics.connectionRejected("auth")
+	metrics.connectionRejected("auth")
+	metrics.transferred(5, 100)
+	metrics.transferred(1, 20)
+
+	var buffer bytes.Buffer
+	metrics.write(&buffer, 2, 1)
+	output := buffer.String()
+
+	expected := []string{
+		"# TYPE gotty_connections gauge\ngotty_connections 2\n",
+		"# TYPE gotty_sessions gauge\ngotty_sessions 1\n",
+		"# TYPE gotty_sessions_total counter\ngotty_sessions_total 3\n",
+		"gotty_rejected_connections_total{reason=\"auth\"} 2\ngotty_rejected_connections_total{reason=\"max_connection\"} 1\n",
+		"gotty_transferred_bytes_total{direction=\"in\"} 6\ngotty_transferred_bytes_total{direction=\"out\"} 120\n",
+		"gotty_session_duration_seconds_bucket{le=\"60\"} 1\n",
+		"gotty_session_duration_seconds_bucket{le=\"3600\"} 1\ngotty_session_duration_seconds_bucket{le=\"14400\"} 2\n",
+		"gotty_session_duration_seconds_bucket{le=\"+Inf\"} 2\ngotty_session_duration_seconds_sum 7230\ngotty_session_duration_seconds_count 2\n",
+		"gotty_command_exits_total{code=\"0\"} 1\ngotty_command_exits_total{code=\"130\"} 1\n",
+	}
+	for _, lines := range expected {
+		if !strings.Contains(output, lines) {
+			t.Errorf("expected the metrics to contain\n%s\ngot\n%s", lines, output)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if !strings.HasPrefix(line, "# HELP gotty_") && !strings.HasPrefix(line, "# TYPE gotty_") && !strings.HasPrefix(line, "gotty_") {
+			t.Errorf("unexpected line %q", line)
+		}
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	cases := []struct {
+		name        string
+		options     func(options *Options)
+		credentials map[string]int
+	}{
+		{"no auth", func(options *Options) {}, map[string]int{"": http.StatusOK}},
+		{"client credentials", func(options *Options) {
+			options.EnableBasicAuth = true
+			options.Credential = "alice:secret"
+		}, map[string]int{"": http.StatusUnauthorized, "alice:wrong": http.StatusUnauthorized, "alice:secret": http.StatusOK}},
+		{"admin credential", func(options *Options) {
+			options.EnableBasicAuth = true
+			options.Credential = "alice:secret"
+			options.AdminCredential = "admin:secret"
+		}, map[string]int{"": http.StatusUnauthorized, "alice:secret": http.StatusUnauthorized, "admin:secret": http.StatusOK}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			options := DefaultOptions
+			options.EnableMetrics = true
+			c.options(&options)
+			server, _ := newTestServer(t, options, nil, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+				return 0
+			}))
+
+			for credential, status := range c.credentials {
+				request, _ := http.NewRequest("GET", server.URL+"/metrics", nil)
+				if credential != "" {
+					parts := strings.SplitN(credential, ":", 2)
+					request.SetBasicAuth(parts[0], parts[1])
+				}
+				response, err := http.DefaultClient.Do(request)
+				if err != nil {
+					t.Fatal(err)
+				}
+				response.Body.Close()
+				if response.StatusCode != status {
+					t.Errorf("expected %d with the credential %q, got %d", status, credential, response.StatusCode)
+				}
+			}
+		})
+	}
+
+	options := DefaultOptions
+	options.EnableMetrics = true
+	options.OIDCIssuer = "https://issuer.example.com"
+	options.OIDCClientID = "gotty"
+	if err := CheckConfig(&options); err == nil {
+		t.Error("expected metrics without the admin credential to be rejected with OpenID Connect")
+	}
+	options.AdminCredential = "admin:secret"
+	if err := CheckConfig(&options); err != nil {
+		t.Errorf("expected metrics with the admin credential to be accepted: %s", err)
+	}
+}
@@ -0,0 +1,527 @@
+package app
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcSessionCookie   = "gotty_session"
+	oidcStateCookie     = "gotty_oidc_state"
+	oidcSessionLifetime = 12 * time.Hour
+	oidcStateLifetime   = 10 * time.Minute
+	// The key set is fetched again for unknown keys at most once in this interval
+	oidcKeysRefreshInterval = time.Minute
+)
+
+// oidcProvider authenticates users with the OpenID Connect authorization code flow
+// and keeps them logged in with a signed session cookie.
+type oidcProvider struct {
+	issuer         string
+	clientID       string
+	clientSecret   string
+	redirectURL    string
+	allowedDomains []string
+	allowedGroups  []string
+	secure         bool
+
+	// Key to sign cookies, regenerated on every start
+	key []byte
+
+	client *http.Client
+
+	configMutex *sync.Mutex
+	config      *oidcConfiguration
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+type oidcConfiguration struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcClaims struct {
+	Issuer        string      `json:"iss"`
+	Subject       string      `json:"sub"`
+	Audience      interface{} `json:"aud"`
+	Expiry        int64       `json:"exp"`
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified *bool       `json:"email_verified"`
+	Groups        []string    `json:"groups"`
+}
+
+type oidcState struct {
+	State    string
+	Nonce    string
+	Redirect string
+	Expires  int64
+}
+
+type oidcSession struct {
+	User    string
+	Expires int64
+}
+
+func newOIDCProvider(options *Options) (*oidcProvider, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &oidcProvider{
+		issuer:         strings.TrimRight(options.OIDCIssuer, "/"),
+		clientID:       options.OIDCClientID,
+		clientSecret:   options.OIDCClientSecret,
+		redirectURL:    options.OIDCRedirectURL,
+		allowedDomains: splitList(options.OIDCAllowedDomains),
+		allowedGroups:  splitList(options.OIDCAllowedGroups),
+		secure:         options.EnableTLS,
+
+		key: key,
+
+		client: &http.Client{Timeout: 10 * time.Second},
+
+		configMutex: &sync.Mutex{},
+	}, nil
+}
+
+// wrapOIDC requires a valid session for the handler and handles the login flow under path.
+// Rejected logins are counted in the metrics.
+func wrapOIDC(handler http.Handler, provider *oidcProvider, path string, metrics *metrics) http.Handler {
+	callbackPath := path + "/oidc/callback"
+	mountPath := provider.mountPath(callbackPath)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == callbackPath {
+			if !provider.handleCallback(w, r, mountPath+callbackPath) {
+				metrics.connectionRejected("auth")
+			}
+			return
+		}
+
+		if _, ok := provider.authenticate(r); ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if err := provider.redirectToLogin(w, r, mountPath, callbackPath); err != nil {
+			requestLogger(r).Error("Failed to start OpenID Connect login", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	})
+}
+
+// authenticate returns the user of a valid session cookie.
+func (provider *oidcProvider) authenticate(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return "", false
+	}
+	var session oidcSession
+	if !verifySignedValue(provider.key, purposeOIDCSession, cookie.Value, &session) {
+		return "", false
+	}
+	if session.User == "" || time.Now().Unix() > session.Expires {
+		return "", false
+	}
+	return session.User, true
+}
+
+// mountPath returns the path the handler is mounted at, in front of the paths it sees,
+// taken from the redirect URL when it ends with the callback path.
+func (provider *oidcProvider) mountPath(callbackPath string) string {
+	if provider.redirectURL == "" {
+		return ""
+	}
+	redirectURL, err := url.Parse(provider.redirectURL)
+	if err != nil || !strings.HasSuffix(redirectURL.Path, callbackPath) {
+		return ""
+	}
+	return strings.TrimSuffix(redirectURL.Path, callbackPath)
+}
+
+// redirectToLogin sends the client to the provider, to come back to the callback path
+// under the mount path.
+func (provider *oidcProvider) redirectToLogin(w http.ResponseWriter, r *http.Request, mountPath string, callbackPath string) error {
+	config, err := provider.configuration()
+	if err != nil {
+		return err
+	}
+	callbackPath = mountPath + callbackPath
+
+	state := oidcState{
+		State:    generateRandomString(32),
+		Nonce:    generateRandomString(32),
+		Redirect: mountPath + r.URL.RequestURI(),
+		Expires:  time.Now().Add(oidcStateLifetime).Unix(),
+	}
+	value, err := signValue(provider.key, purposeOIDCState, state)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     callbackPath,
+		HttpOnly: true,
+		Secure:   provider.secure,
+	})
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.clientID)
+	query.Set("redirect_uri", provider.callbackURL(r, callbackPath))
+	query.Set("scope", "openid email profile")
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+
+	http.Redirect(w, r, config.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+	return nil
+}
+
+// handleCallback finishes the login and returns false when it's rejected.
+// The callback path includes the mount path.
+func (provider *oidcProvider) handleCallback(w http.ResponseWriter, r *http.Request, callbackPath string) bool {
+	var state oidcState
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || !verifySignedValue(provider.key, purposeOIDCState, cookie.Value, &state) ||
+		time.Now().Unix() > state.Expires || r.URL.Query().Get("state") != state.State {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return false
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: callbackPath, MaxAge: -1})
+
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		requestLogger(r).Warn("OpenID Connect login failed", "remote_addr", r.RemoteAddr, "error", errorCode)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return false
+	}
+
+	claims, err := provider.exchange(r.URL.Query().Get("code"), provider.callbackURL(r, callbackPath))
+	if err != nil {
+		requestLogger(r).Warn("OpenID Connect login failed", "remote_addr", r.RemoteAddr, "error", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return false
+	}
+	if claims.Nonce != state.Nonce {
+		requestLogger(r).Warn("OpenID Connect login failed", "remote_addr", r.RemoteAddr, "error", "nonce mismatch")
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return false
+	}
+
+	user := claims.Email
+	if user == "" {
+		user = claims.Subject
+	}
+	if user == "" {
+		requestLogger(r).Warn("OpenID Connect login failed", "remote_addr", r.RemoteAddr, "error", "no subject in ID token")
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return false
+	}
+	if !provider.allowed(claims) {
+		requestLogger(r).Warn("OpenID Connect user is not allowed", "remote_addr", r.RemoteAddr, "user", user)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	value, err := signValue(provider.key, purposeOIDCSession, oidcSession{
+		User:    user,
+		Expires: time.Now().Add(oidcSessionLifetime).Unix(),
+	})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcSessionCookie,
+		Value:    value,
+		Path:     strings.TrimSuffix(callbackPath, "/oidc/callback") + "/",
+		HttpOnly: true,
+		Secure:   provider.secure,
+	})
+
+	requestLogger(r).Info("OpenID Connect Authentication Succeeded", "remote_addr", r.RemoteAddr, "user", user)
+	http.Redirect(w, r, state.Redirect, http.StatusFound)
+	return true
+}
+
+func (provider *oidcProvider) callbackURL(r *http.Request, callbackPath string) string {
+	if provider.redirectURL != "" {
+		return provider.redirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return (&url.URL{Scheme: scheme, Host: r.Host, Path: callbackPath}).String()
+}
+
+func (provider *oidcProvider) allowed(claims *oidcClaims) bool {
+	if len(provider.allowedDomains) == 0 && len(provider.allowedGroups) == 0 {
+		return true
+	}
+
+	// Providers which don't say that the email is verified may let users set any email
+	if claims.Email != "" && claims.EmailVerified != nil && *claims.EmailVerified {
+		domain := claims.Email[strings.LastIndex(claims.Email, "@")+1:]
+		for _, allowed := range provider.allowedDomains {
+			if strings.EqualFold(domain, allowed) {
+				return true
+			}
+		}
+	}
+	for _, group := range claims.Groups {
+		for _, allowed := range provider.allowedGroups {
+			if group == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exchange redeems an authorization code and returns the verified claims of the ID token.
+func (provider *oidcProvider) exchange(code string, redirectURL string) (*oidcClaims, error) {
+	config, err := provider.configuration()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	req, err := http.NewRequest("POST", config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(provider.clientID), url.QueryEscape(provider.clientSecret))
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Token endpoint returned " + resp.Status)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("No ID token in token response")
+	}
+
+	return provider.verifyIDToken(token.IDToken)
+}
+
+func (provider *oidcProvider) verifyIDToken(idToken string) (*oidcClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed ID token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := provider.signingKey(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Algorithm {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errors.New("Invalid ID token signature")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 ||
+			!ecdsa.Verify(ecKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			return nil, errors.New("Invalid ID token signature")
+		}
+	default:
+		return nil, errors.New("Unsupported ID token algorithm: " + header.Algorithm)
+	}
+
+	var claims oidcClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(claims.Issuer, "/") != provider.issuer {
+		return nil, errors.New("ID token issuer mismatch: " + claims.Issuer)
+	}
+	if !audienceContains(claims.Audience, provider.clientID) {
+		return nil, errors.New("ID token audience mismatch")
+	}
+	if time.Now().Unix() > claims.Expiry {
+		return nil, errors.New("ID token expired")
+	}
+
+	return &claims, nil
+}
+
+// configuration fetches the discovery document of the issuer once.
+func (provider *oidcProvider) configuration() (*oidcConfiguration, error) {
+	provider.configMutex.Lock()
+	defer provider.configMutex.Unlock()
+
+	if provider.config != nil {
+		return provider.config, nil
+	}
+
+	var config oidcConfiguration
+	if err := provider.getJSON(provider.issuer+"/.well-known/openid-configuration", &config); err != nil {
+		return nil, err
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JWKSURI == "" {
+		return nil, errors.New("Incomplete OpenID Connect discovery document")
+	}
+	provider.config = &config
+	return provider.config, nil
+}
+
+// signingKey returns the key with the ID, refreshing the key set when not found
+// unless it has just been fetched, so that tokens with made up key IDs can't flood the provider.
+func (provider *oidcProvider) signingKey(keyID string) (crypto.PublicKey, error) {
+	config, err := provider.configuration()
+	if err != nil {
+		return nil, err
+	}
+
+	provider.configMutex.Lock()
+	defer provider.configMutex.Unlock()
+
+	if key, ok := provider.keys[keyID]; ok {
+		return key, nil
+	}
+	if time.Since(provider.keysFetched) < oidcKeysRefreshInterval {
+		return nil, errors.New("Unknown ID token signing key: " + keyID)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := provider.getJSON(config.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		switch jwk.KeyType {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[jwk.KeyID] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			x, err1 := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if err1 != nil || err2 != nil || jwk.Curve != "P-256" {
+				continue
+			}
+			keys[jwk.KeyID] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+	provider.keys = keys
+	provider.keysFetched = time.Now()
+
+	key, ok := keys[keyID]
+	if !ok {
+		return nil, errors.New("Unknown ID token signing key: " + keyID)
+	}
+	return key, nil
+}
+
+func (provider *oidcProvider) getJSON(url string, v interface{}) error {
+	resp, err := provider.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(url + " returned " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	payload, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func audienceContains(audience interface{}, clientID string) bool {
+	switch aud := audience.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated option value.
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
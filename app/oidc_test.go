@@ -0,0 +1,457 @@
+package app
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// mockIdP is an OpenID Connect provider which issues ID tokens for the code "code".
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// Added to the claims of the issued ID tokens, overriding the defaults
+	claims map[string]interface{}
+	// Nonce of the last login started, used unless the claims have one
+	nonce string
+	// Number of requests for the key set
+	keyRequests int32
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, claims: map[string]interface{}{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&idp.keyRequests, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "gotty" || secret != "secret" || r.FormValue("code") != "code" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idToken(t)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) idToken(t *testing.T) string {
+	claims := map[string]interface{}{
+		"iss":            idp.server.URL,
+		"aud":            "gotty",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"sub":            "1234",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"nonce":          idp.nonce,
+	}
+	for key, value := range idp.claims {
+		claims[key] = value
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestOIDCHandler(t *testing.T, idp *mockIdP, options Options) (http.Handler, *oidcProvider) {
+	options.OIDCIssuer = idp.server.URL
+	options.OIDCClientID = "gotty"
+	options.OIDCClientSecret = "secret"
+	provider, err := newOIDCProvider(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := provider.authenticate(r)
+		w.Write([]byte("hello " + user))
+	})
+	return wrapOIDC(protected, provider, "", newMetrics()), provider
+}
+
+func serve(handler http.Handler, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name && cookie.MaxAge >= 0 {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// startLogin requests a page without a session and returns the state cookie
+// and the query of the redirect to the provider.
+func startLogin(t *testing.T, handler http.Handler, idp *mockIdP) (*http.Cookie, url.Values) {
+	w := serve(handler, "/?arg=1")
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), idp.server.URL+"/authorize?") {
+		t.Fatalf("unexpected redirect to %s", location)
+	}
+	cookie := responseCookie(w, oidcStateCookie)
+	if cookie == nil {
+		t.Fatal("no state cookie")
+	}
+	idp.nonce = location.Query().Get("nonce")
+	return cookie, location.Query()
+}
+
+func callback(handler http.Handler, state string, stateCookie *http.Cookie) *httptest.ResponseRecorder {
+	return serve(handler, "/oidc/callback?code=code&state="+url.QueryEscape(state), stateCookie)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	handler, _ := newTestOIDCHandler(t, idp, DefaultOptions)
+
+	stateCookie, query := startLogin(t, handler, idp)
+	if query.Get("client_id") != "gotty" || query.Get("redirect_uri") != "http://example.com/oidc/callback" {
+		t.Fatalf("unexpected authorization request %v", query)
+	}
+
+	w := callback(handler, query.Get("state"), stateCookie)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/?arg=1" {
+		t.Fatalf("expected a redirect to the original page, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	session := responseCookie(w, oidcSessionCookie)
+	if session == nil {
+		t.Fatal("no session cookie")
+	}
+
+	w = serve(handler, "/", session)
+	if w.Code != http.StatusOK || w.Body.String() != "hello alice@example.com" {
+		t.Fatalf("expected the page for alice, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestOIDCMountPath(t *testing.T) {
+	idp := newMockIdP(t)
+	options := DefaultOptions
+	options.OIDCRedirectURL = "https://example.com/terminal/oidc/callback"
+	handler, _ := newTestOIDCHandler(t, idp, options)
+	handler = http.StripPrefix("/terminal", handler)
+
+	w := serve(handler, "/terminal/?arg=1")
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get("redirect_uri") != options.OIDCRedirectURL {
+		t.Fatalf("unexpected redirect URL %s", location.Query().Get("redirect_uri"))
+	}
+	stateCookie := responseCookie(w, oidcStateCookie)
+	if stateCookie == nil || stateCookie.Path != "/terminal/oidc/callback" {
+		t.Fatalf("expected the state cookie for the mounted callback, got %v", stateCookie)
+	}
+	idp.nonce = location.Query().Get("nonce")
+
+	w = serve(handler, "/terminal/oidc/callback?code=code&state="+url.QueryEscape(location.Query().Get("state")), stateCookie)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/terminal/?arg=1" {
+		t.Fatalf("expected a redirect to the mounted page, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	session := responseCookie(w, oidcSessionCookie)
+	if session == nil || session.Path != "/terminal/" {
+		t.Fatalf("expected the session cookie for the mount path, got %v", session)
+	}
+}
+
+func TestOIDCDiscoveryFailure(t *testing.T) {
+	idp := newMockIdP(t)
+	handler, _ := newTestOIDCHandler(t, idp, DefaultOptions)
+	idp.server.Close()
+
+	if w := serve(handler, "/"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected an error without discovery, got %d", w.Code)
+	}
+}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	handler, _ := newTestOIDCHandler(t, idp, DefaultOptions)
+	stateCookie, _ := startLogin(t, handler, idp)
+
+	if w := callback(handler, "forged", stateCookie); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a state mismatch to be rejected, got %d", w.Code)
+	}
+	if w := serve(handler, "/oidc/callback?code=code&state=forged"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a callback without a state cookie to be rejected, got %d", w.Code)
+	}
+}
+
+func TestOIDCRejectedIDTokens(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"nonce":    {"nonce": "replayed"},
+		"expiry":   {"exp": time.Now().Add(-time.Minute).Unix()},
+		"audience": {"aud": "other"},
+		"issuer":   {"iss": "https://other.example.com"},
+		"subject":  {"sub": "", "email": ""},
+	}
+	for name, claims := range cases {
+		t.Run(name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims = claims
+			handler, _ := newTestOIDCHandler(t, idp, DefaultOptions)
+			stateCookie, query := startLogin(t, handler, idp)
+
+			w := callback(handler, query.Get("state"), stateCookie)
+			if w.Code != http.StatusUnauthorized || responseCookie(w, oidcSessionCookie) != nil {
+				t.Fatalf("expected the ID token to be rejected, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestOIDCAllowedUsers(t *testing.T) {
+	cases := []struct {
+		name    string
+		domains string
+		groups  string
+		claims  map[string]interface{}
+		allowed bool
+	}{
+		{"domain", "example.com", "", map[string]interface{}{}, true},
+		{"other domain", "example.org", "", map[string]interface{}{}, false},
+		{"unverified email", "example.com", "", map[string]interface{}{"email_verified": false}, false},
+		{"email without verification", "example.com", "", map[string]interface{}{"email_verified": nil}, false},
+		{"group", "example.org", "admins", map[string]interface{}{"groups": []string{"users", "admins"}}, true},
+		{"other group", "", "admins", map[string]interface{}{"groups": []string{"users"}}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims = c.claims
+			options := DefaultOptions
+			options.OIDCAllowedDomains = c.domains
+			options.OIDCAllowedGroups = c.groups
+			handler, _ := newTestOIDCHandler(t, idp, options)
+			stateCookie, query := startLogin(t, handler, idp)
+
+			w := callback(handler, query.Get("state"), stateCookie)
+			if c.allowed && w.Code != http.StatusFound {
+				t.Fatalf("expected the user to be allowed, got %d", w.Code)
+			}
+			if !c.allowed && (w.Code != http.StatusForbidden || responseCookie(w, oidcSessionCookie) != nil) {
+				t.Fatalf("expected the user to be rejected, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestOIDCExpiredSession(t *testing.T) {
+	idp := newMockIdP(t)
+	handler, provider := newTestOIDCHandler(t, idp, DefaultOptions)
+
+	value, err := signValue(provider.key, purposeOIDCSession, oidcSession{
+		User:    "alice@example.com",
+		Expires: time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(handler, "/", &http.Cookie{Name: oidcSessionCookie, Value: value}); w.Code != http.StatusFound {
+		t.Fatalf("expected an expired session to be redirected to login, got %d", w.Code)
+	}
+}
+
+func TestOIDCCookieTypes(t *testing.T) {
+	idp := newMockIdP(t)
+	handler, provider := newTestOIDCHandler(t, idp, DefaultOptions)
+	stateCookie, query := startLogin(t, handler, idp)
+
+	// The state cookie given to anyone must not be accepted as a session
+	if w := serve(handler, "/", &http.Cookie{Name: oidcSessionCookie, Value: stateCookie.Value}); w.Code != http.StatusFound {
+		t.Fatalf("expected a state cookie to be rejected as a session, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Nor a connection token, nor a session of no user
+	token, err := signValue(provider.key, purposeConnectionToken, connectionToken{Nonce: "n", User: "alice", Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(handler, "/", &http.Cookie{Name: oidcSessionCookie, Value: token}); w.Code != http.StatusFound {
+		t.Fatalf("expected a connection token to be rejected as a session, got %d", w.Code)
+	}
+	anonymous, err := signValue(provider.key, purposeOIDCSession, oidcSession{Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(handler, "/", &http.Cookie{Name: oidcSessionCookie, Value: anonymous}); w.Code != http.StatusFound {
+		t.Fatalf("expected a session without a user to be rejected, got %d", w.Code)
+	}
+
+	// And a session cookie must not be accepted as a state
+	w := callback(handler, query.Get("state"), stateCookie)
+	session := responseCookie(w, oidcSessionCookie)
+	if session == nil {
+		t.Fatalf("login failed with %d", w.Code)
+	}
+	if w := callback(handler, "", &http.Cookie{Name: oidcStateCookie, Value: session.Value}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a session cookie to be rejected as a state, got %d", w.Code)
+	}
+}
+
+func TestOIDCKeyRefresh(t *testing.T) {
+	idp := newMockIdP(t)
+	_, provider := newTestOIDCHandler(t, idp, DefaultOptions)
+
+	if _, err := provider.signingKey("test"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := provider.signingKey("unknown"); err == nil {
+			t.Fatal("expected an unknown key to be rejected")
+		}
+	}
+	if requests := atomic.LoadInt32(&idp.keyRequests); requests != 1 {
+		t.Fatalf("expected the key set to be fetched once, got %d", requests)
+	}
+
+	provider.keysFetched = time.Now().Add(-oidcKeysRefreshInterval)
+	provider.signingKey("unknown")
+	if requests := atomic.LoadInt32(&idp.keyRequests); requests != 2 {
+		t.Fatalf("expected the key set to be fetched again after the interval, got %d", requests)
+	}
+}
+
+func TestOIDCWebSocket(t *testing.T) {
+	idp := newMockIdP(t)
+	options := DefaultOptions
+	options.OIDCIssuer = idp.server.URL
+	options.OIDCClientID = "gotty"
+	options.OIDCClientSecret = "secret"
+	options.OIDCRedirectURL = "http://gotty.example.com/oidc/callback"
+	server, _ := newTestServer(t, options, nil, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "authenticated")
+		<-ctx.Done()
+		return 0
+	}))
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func(target string, cookies ...*http.Cookie) *http.Response {
+		request, _ := http.NewRequest("GET", target, nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	cookie := func(response *http.Response, name string) *http.Cookie {
+		for _, cookie := range response.Cookies() {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+		t.Fatalf("no cookie %s", name)
+		return nil
+	}
+
+	response := get(server.URL + "/")
+	response.Body.Close()
+	location, _ := url.Parse(response.Header.Get("Location"))
+	idp.nonce = location.Query().Get("nonce")
+	response = get(server.URL+"/oidc/callback?code=code&state="+url.QueryEscape(location.Query().Get("state")), cookie(response, oidcStateCookie))
+	response.Body.Close()
+	session := cookie(response, oidcSessionCookie)
+
+	token := func() string {
+		response := get(server.URL+"/auth_token", session)
+		defer response.Body.Close()
+		var body struct{ Token string }
+		if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Token
+	}
+	dial := func(token string, cookies ...*http.Cookie) *websocket.Conn {
+		header := http.Header{}
+		for _, cookie := range cookies {
+			header.Add("Cookie", cookie.String())
+		}
+		dialer := websocket.Dialer{Subprotocols: []string{binaryProtocol}}
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		init, _ := json.Marshal(InitMessage{AuthToken: token})
+		conn.WriteMessage(websocket.TextMessage, init)
+		return conn
+	}
+
+	// A token without the session, e.g. after logging out, is not enough
+	conn := dial(token())
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if strings.Contains(string(data), "authenticated") {
+			t.Fatal("expected the connection without a session to be rejected")
+		}
+	}
+
+	readMessage(t, dial(token(), session), Output, "authenticated")
+}
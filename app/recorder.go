@@ -0,0 +1,124 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// recorder writes the PTY output of a session into an asciicast v2 file.
+// See https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+type recorder struct {
+	file    *os.File
+	start   time.Time
+	mutex   *sync.Mutex
+	pending []byte
+	closed  bool
+}
+
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+func newRecorder(dir string, header asciicastHeader, suffix string) (*recorder, error) {
+	dir = ExpandHomeDir(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s.cast", start.Format("20060102-150405"), suffix)
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Version = 2
+	header.Timestamp = start.Unix()
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Write(append(headerJSON, '\n')); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &recorder{
+		file:  file,
+		start: start,
+		mutex: &sync.Mutex{},
+	}, nil
+}
+
+func (recorder *recorder) name() string {
+	return recorder.file.Name()
+}
+
+func (recorder *recorder) writeOutput(data []byte) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	// A chunk read from the PTY can end in the middle of a UTF-8 sequence.
+	// Hold incomplete trailing bytes back until the next chunk arrives.
+	buf := append(recorder.pending, data...)
+	complete := len(buf)
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				complete = i
+			}
+			break
+		}
+	}
+	recorder.pending = append([]byte{}, buf[complete:]...)
+	if complete == 0 {
+		return nil
+	}
+
+	return recorder.writeEvent("o", string(buf[:complete]))
+}
+
+func (recorder *recorder) writeResize(columns int, rows int) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	return recorder.writeEvent("r", fmt.Sprintf("%dx%d", columns, rows))
+}
+
+func (recorder *recorder) writeEvent(eventType string, data string) error {
+	if recorder.closed {
+		return nil
+	}
+
+	elapsed := time.Since(recorder.start).Seconds()
+	event, err := json.Marshal([]interface{}{elapsed, eventType, data})
+	if err != nil {
+		return err
+	}
+	_, err = recorder.file.Write(append(event, '\n'))
+	return err
+}
+
+func (recorder *recorder) close() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if len(recorder.pending) > 0 {
+		recorder.writeEvent("o", string(recorder.pending))
+		recorder.pending = nil
+	}
+	recorder.closed = true
+	return recorder.file.Close()
+}
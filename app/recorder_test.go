@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func readCast(t *testing.T, name string) (asciicastHeader, [][]interface{}) {
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	header := asciicastHeader{}
+	if !scanner.Scan() {
+		t.Fatal("expected a header")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatal(err)
+	}
+	events := [][]interface{}{}
+	for scanner.Scan() {
+		event := []interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return header, events
+}
+
+func TestRecorder(t *testing.T) {
+	recorder, err := newRecorder(t.TempDir(), asciicastHeader{Width: 80, Height: 24, Command: "bash"}, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "é" split across two chunks, and an incomplete "€" flushed on closing
+	recorder.writeOutput([]byte("caf\xc3"))
+	recorder.writeOutput([]byte("\xa9!"))
+	recorder.writeResize(120, 40)
+	recorder.writeOutput([]byte("\xe2\x82"))
+	if err := recorder.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	header, events := readCast(t, recorder.name())
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Command != "bash" {
+		t.Fatalf("unexpected header %+v", header)
+	}
+
+	expected := [][2]string{{"o", "caf"}, {"o", "é!"}, {"r", "120x40"}, {"o", "\ufffd\ufffd"}}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %v", len(expected), events)
+	}
+	for i, event := range events {
+		if event[1] != expected[i][0] || event[2] != expected[i][1] {
+			t.Errorf("expected the event %q, got %q", expected[i], event[1:])
+		}
+	}
+
+	if err := recorder.writeOutput([]byte("late")); err != nil {
+		t.Fatal(err)
+	}
+	if _, events := readCast(t, recorder.name()); len(events) != len(expected) {
+		t.Fatal("expected no events after closing")
+	}
+}
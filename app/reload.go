@@ -0,0 +1,243 @@
+package app
+
+import (
+	"crypto/tls"
+	"net"
+	"reflect"
+	"sort"
+	"text/template"
+)
+
+// Options applied to the running server by Reload, by their names in the config file.
+// The others, except the credentials of clients, require a restart.
+var reloadableOptions = map[string]bool{
+	"preferences":    true,
+	"title_format":   true,
+	"max_connection": true,
+	"tls_crt_file":   true,
+	"tls_key_file":   true,
+}
+
+// Options of the credentials of clients, applied by Reload unless authentication
+// is enabled or disabled by them.
+var credentialOptions = map[string]bool{
+	"enable_basic_auth": true,
+	"credential":        true,
+	"htpasswd_file":     true,
+	"token_file":        true,
+}
+
+// Reload applies the options, read again from the config file, to the running server
+// without closing sessions. Credentials, preferences, title formats, the maximum number
+// of connections and TLS certificates are applied, and the htpasswd, token and certificate
+// files are read again even when their paths are unchanged.
+// The changed options are logged with those which require a restart.
+func (app *App) Reload(options *Options) error {
+	if err := CheckConfig(options); err != nil {
+		return err
+	}
+
+	authenticators, err := newAuthenticators(options)
+	if err != nil {
+		return err
+	}
+	// Whether clients and the admin API are authenticated is decided when the server starts,
+	// only the credentials can be changed
+	reloadCredentials := (len(authenticators) > 0) == (len(app.currentAuthenticators()) > 0)
+	reloadAdminCredential := (options.AdminCredential != "") == (app.options.AdminCredential != "")
+
+	applied, restart := []string{}, []string{}
+	for _, name := range changedOptions(app.options, options) {
+		if reloadableOptions[name] ||
+			(reloadCredentials && credentialOptions[name]) ||
+			(reloadAdminCredential && name == "admin_credential") {
+			applied = append(applied, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+
+	routes, err := newRoutes(app.command, options)
+	if err != nil {
+		return err
+	}
+
+	app.reloadMutex.RLock()
+	serveTLS := app.certificate != nil
+	app.reloadMutex.RUnlock()
+
+	var certificate *tls.Certificate
+	if serveTLS {
+		certificate, err = loadCertificate(options)
+		if err != nil {
+			return err
+		}
+	}
+
+	app.reloadMutex.Lock()
+	defer app.reloadMutex.Unlock()
+
+	if reloadCredentials {
+		app.authenticators = authenticators
+		app.options.EnableBasicAuth = options.EnableBasicAuth
+		app.options.Credential = options.Credential
+		app.options.HtpasswdFile = options.HtpasswdFile
+		app.options.TokenFile = options.TokenFile
+	}
+	if reloadAdminCredential {
+		app.options.AdminCredential = options.AdminCredential
+	}
+	app.options.Preferences = options.Preferences
+	app.options.RawPreferences = options.RawPreferences
+	app.options.TitleFormat = options.TitleFormat
+	app.options.MaxConnection = options.MaxConnection
+	app.options.TLSCrtFile = options.TLSCrtFile
+	app.options.TLSKeyFile = options.TLSKeyFile
+
+	// The commands themselves are unchanged, only their titles and preferences are updated
+	if !contains(restart, "command") {
+		app.options.Commands = options.Commands
+	}
+	for _, route := range app.routes {
+		for _, reloaded := range routes {
+			if reloaded.name == route.name {
+				route.titleTemplate = reloaded.titleTemplate
+				route.options = reloaded.options
+			}
+		}
+	}
+
+	if certificate != nil {
+		app.certificate = certificate
+	}
+
+	app.logger.Info("Configuration reloaded", "applied", applied, "certificate_reloaded", certificate != nil)
+	if len(restart) > 0 {
+		app.logger.Warn("Some options are changed but require a restart to be applied", "options", restart)
+	}
+	return nil
+}
+
+// changedOptions returns the names of the options which differ.
+// A command is changed only when other than its title format and preferences differ.
+func changedOptions(current *Options, options *Options) []string {
+	names := map[string]bool{}
+
+	currentValue := reflect.ValueOf(*current)
+	value := reflect.ValueOf(*options)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Name == "Commands" {
+			continue
+		}
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), value.Field(i).Interface()) {
+			names[field.Tag.Get("hcl")] = true
+		}
+	}
+
+	if !reflect.DeepEqual(commandsToRestart(current.Commands), commandsToRestart(options.Commands)) {
+		names["command"] = true
+	} else if !reflect.DeepEqual(current.Commands, options.Commands) {
+		names["title_format"] = true
+		names["preferences"] = true
+	}
+
+	changed := []string{}
+	for name := range names {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// commandsToRestart returns the commands without the options applied by Reload.
+func commandsToRestart(commands map[string]CommandOptions) map[string]CommandOptions {
+	result := make(map[string]CommandOptions)
+	for name, command := range commands {
+		command.TitleFormat = ""
+		command.Preferences = HtermPrefernces{}
+		command.RawPreferences = nil
+		result[name] = command
+	}
+	return result
+}
+
+func contains(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+func loadCertificate(options *Options) (*tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(ExpandHomeDir(options.TLSCrtFile), ExpandHomeDir(options.TLSKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// listenAndServeTLS serves with the certificate replaced by Reload.
+func (app *App) listenAndServeTLS(endpoint string) error {
+	certificate, err := loadCertificate(app.options)
+	if err != nil {
+		return err
+	}
+	app.reloadMutex.Lock()
+	app.certificate = certificate
+	app.reloadMutex.Unlock()
+
+	config := &tls.Config{}
+	if app.server.TLSConfig != nil {
+		config = app.server.TLSConfig.Clone()
+	}
+	config.NextProtos = []string{"http/1.1"}
+	config.GetCertificate = app.getCertificate
+
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return err
+	}
+	return app.server.Serve(tls.NewListener(listener, config))
+}
+
+func (app *App) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	app.reloadMutex.RLock()
+	defer app.reloadMutex.RUnlock()
+	return app.certificate, nil
+}
+
+func (app *App) currentAuthenticators() []Authenticator {
+	app.reloadMutex.RLock()
+	defer app.reloadMutex.RUnlock()
+	return app.authenticators
+}
+
+func (app *App) adminAuthenticators() []Authenticator {
+	app.reloadMutex.RLock()
+	defer app.reloadMutex.RUnlock()
+	return []Authenticator{newCredentialAuthenticator(app.options.AdminCredential)}
+}
+
+func (app *App) maxConnection() int {
+	app.reloadMutex.RLock()
+	defer app.reloadMutex.RUnlock()
+	return app.options.MaxConnection
+}
+
+// clientSettings returns the title template and the hterm preferences for clients of the route.
+func (app *App) clientSettings(route *route) (*template.Template, map[string]interface{}) {
+	app.reloadMutex.RLock()
+	defer app.reloadMutex.RUnlock()
+
+	htermPrefs := htermPreferences(app.options.Preferences, app.options.RawPreferences)
+	if route.options != nil {
+		commandPrefs := htermPreferences(route.options.Preferences, route.options.RawPreferences)
+		for key, value := range commandPrefs {
+			htermPrefs[key] = value
+		}
+	}
+	return route.titleTemplate, htermPrefs
+}
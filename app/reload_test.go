@@ -0,0 +1,96 @@
+package app
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestChangedOptions(t *testing.T) {
+	current := DefaultOptions
+	current.Commands = map[string]CommandOptions{"top": {Command: []string{"top"}}}
+
+	title := current
+	title.Commands = map[string]CommandOptions{"top": {Command: []string{"top"}, TitleFormat: "top"}}
+	command := current
+	command.Commands = map[string]CommandOptions{"top": {Command: []string{"htop"}}}
+	credentials := current
+	credentials.Credential = "alice:new"
+	credentials.MaxConnection = 3
+	port := current
+	port.Port = "9000"
+
+	cases := map[string]struct {
+		options Options
+		changed []string
+	}{
+		"none":          {current, []string{}},
+		"port":          {port, []string{"port"}},
+		"credentials":   {credentials, []string{"credential", "max_connection"}},
+		"command title": {title, []string{"preferences", "title_format"}},
+		"command":       {command, []string{"command"}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if changed := changedOptions(&current, &c.options); !reflect.DeepEqual(changed, c.changed) {
+				t.Fatalf("expected the options %v to be changed, got %v", c.changed, changed)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	options := DefaultOptions
+	options.EnableBasicAuth = true
+	options.Credential = "alice:secret"
+	options.TitleFormat = "old"
+	options.LogLevel = "error"
+	app, err := New([]string{"bash"}, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := options
+	reloaded.Credential = "alice:new"
+	reloaded.TitleFormat = "new"
+	reloaded.MaxConnection = 5
+	reloaded.Port = "9000"
+	if err := app.Reload(&reloaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := authenticateCredential(app.currentAuthenticators(), "alice:new"); !ok {
+		t.Error("expected the new credential to be accepted")
+	}
+	if _, ok := authenticateCredential(app.currentAuthenticators(), "alice:secret"); ok {
+		t.Error("expected the old credential to be rejected")
+	}
+	if app.maxConnection() != 5 {
+		t.Errorf("expected the max connection 5, got %d", app.maxConnection())
+	}
+	title := &bytes.Buffer{}
+	titleTemplate, _ := app.clientSettings(app.routes[0])
+	titleTemplate.Execute(title, nil)
+	if title.String() != "new" {
+		t.Errorf("expected the new title, got %q", title.String())
+	}
+	if app.options.Port != DefaultOptions.Port {
+		t.Errorf("expected the port to require a restart, got %s", app.options.Port)
+	}
+
+	// Authentication can't be disabled by a reload
+	disabled := reloaded
+	disabled.EnableBasicAuth = false
+	if err := app.Reload(&disabled); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := authenticateCredential(app.currentAuthenticators(), "alice:new"); !ok {
+		t.Error("expected the credential to be kept")
+	}
+
+	invalid := reloaded
+	invalid.TitleFormat = "{{ .Command"
+	if err := app.Reload(&invalid); err == nil {
+		t.Error("expected an invalid title format to be rejected")
+	}
+}
@@ -0,0 +1,378 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+type asciicast struct {
+	header   asciicastHeader
+	events   []asciicastEvent
+	duration float64
+}
+
+type asciicastEvent struct {
+	Time float64
+	Type string
+	Data string
+}
+
+type argReplayControl struct {
+	Action   string
+	Speed    float64
+	Position float64
+}
+
+type replayStatus struct {
+	Playing  bool
+	Speed    float64
+	Position float64
+	Duration float64
+}
+
+// replayPlayer streams a recorded session to a client as if it were a live PTY.
+type replayPlayer struct {
+	context  *clientContext
+	cast     *asciicast
+	controls chan argReplayControl
+	stopped  chan bool
+
+	index    int
+	position float64
+	playing  bool
+	speed    float64
+}
+
+// NewReplay creates a server which plays an asciicast v2 file
+// recorded with the RecordDir option (or by asciinema) to its clients.
+func NewReplay(castFile string, options *Options) (*App, error) {
+	cast, err := loadAsciicast(ExpandHomeDir(castFile))
+	if err != nil {
+		return nil, err
+	}
+
+	replayOptions := *options
+	replayOptions.PermitWrite = false
+	replayOptions.Operators = ""
+	replayOptions.Commands = nil
+	replayOptions.Users = nil
+	replayOptions.Shared = false
+	replayOptions.RecordDir = ""
+
+	app, err := New([]string{"replay", castFile}, &replayOptions)
+	if err != nil {
+		return nil, err
+	}
+	app.replay = cast
+
+	return app, nil
+}
+
+func loadAsciicast(path string) (*asciicast, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("Empty asciicast file: " + path)
+	}
+
+	cast := &asciicast{}
+	if err := json.Unmarshal(scanner.Bytes(), &cast.header); err != nil {
+		return nil, errors.New("Failed to parse asciicast header: " + err.Error())
+	}
+	if cast.header.Version != 2 {
+		return nil, errors.New("Unsupported asciicast version, only version 2 is supported")
+	}
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var raw []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+			return nil, errors.New("Failed to parse asciicast event: " + err.Error())
+		}
+		if len(raw) != 3 {
+			return nil, errors.New("Malformed asciicast event")
+		}
+		eventTime, ok1 := raw[0].(float64)
+		eventType, ok2 := raw[1].(string)
+		eventData, ok3 := raw[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, errors.New("Malformed asciicast event")
+		}
+		cast.events = append(cast.events, asciicastEvent{eventTime, eventType, eventData})
+		cast.duration = eventTime
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cast, nil
+}
+
+func (context *clientContext) goHandleReplay() {
+	player := &replayPlayer{
+		context:  context,
+		cast:     context.app.replay,
+		controls: make(chan argReplayControl),
+		stopped:  make(chan bool),
+		playing:  true,
+		speed:    1,
+	}
+
+	go func() {
+		defer context.app.finishRoutine()
+		defer func() {
+			connections := atomic.AddInt64(context.app.connections, -1)
+			context.logger.Info("Connection closed", "connections", connections)
+			if connections == 0 {
+				context.app.restartTimer()
+			}
+		}()
+
+		if err := context.sendInitialize(); err != nil {
+			context.logger.Warn("Failed to initialize client", "error", err)
+			context.connection.Close()
+			return
+		}
+
+		done := make(chan bool)
+		go func() {
+			defer close(done)
+			context.processReplayReceive(player)
+		}()
+
+		player.run(done)
+		context.connection.Close()
+	}()
+}
+
+func (context *clientContext) processReplayReceive(player *replayPlayer) {
+	for {
+		_, data, err := context.connection.ReadMessage()
+		if err != nil {
+			context.logger.Info("Client disconnected", "reason", err)
+			return
+		}
+		if len(data) == 0 {
+			context.logger.Warn("Received an empty message")
+			return
+		}
+
+		switch data[0] {
+		case Input, ResizeTerminal:
+			// A recorded session can't be written to or resized
+		case Ping:
+			if err := context.write([]byte{Pong}); err != nil {
+				context.logger.Warn("Failed to send pong", "error", err)
+				return
+			}
+		case ReplayControl:
+			var args argReplayControl
+			if err := json.Unmarshal(data[1:], &args); err != nil {
+				context.logger.Warn("Malformed remote command", "error", err)
+				return
+			}
+			select {
+			case player.controls <- args:
+			case <-player.stopped:
+				return
+			}
+		default:
+			context.logger.Warn("Unknown message type", "type", string(data[0]))
+			return
+		}
+	}
+}
+
+func (player *replayPlayer) run(done <-chan bool) {
+	defer close(player.stopped)
+
+	if err := player.sendSize(player.cast.header.Width, player.cast.header.Height); err != nil {
+		player.context.logger.Warn("Failed to send terminal size", "error", err)
+		return
+	}
+	if err := player.sendStatus(); err != nil {
+		player.context.logger.Warn("Failed to send replay status", "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		// position advances in real time while waiting for the next event
+		waitStart := time.Now()
+		var timer *time.Timer
+		var next <-chan time.Time
+		if player.playing && player.index < len(player.cast.events) {
+			wait := (player.cast.events[player.index].Time - player.position) / player.speed
+			timer = time.NewTimer(time.Duration(wait * float64(time.Second)))
+			next = timer.C
+		}
+
+		var err error
+		select {
+		case <-done:
+			return
+
+		case <-next:
+			err = player.emitUntil(player.cast.events[player.index].Time)
+			if player.index >= len(player.cast.events) {
+				player.playing = false
+				if err == nil {
+					err = player.sendStatus()
+				}
+			}
+
+		case <-ticker.C:
+			if player.playing {
+				player.advance(time.Since(waitStart))
+				err = player.sendStatus()
+			}
+
+		case control := <-player.controls:
+			if player.playing {
+				player.advance(time.Since(waitStart))
+			}
+			err = player.control(control)
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			player.context.logger.Warn("Failed to replay", "error", err)
+			return
+		}
+	}
+}
+
+func (player *replayPlayer) advance(elapsed time.Duration) {
+	player.position += elapsed.Seconds() * player.speed
+	if player.index < len(player.cast.events) && player.position > player.cast.events[player.index].Time {
+		player.position = player.cast.events[player.index].Time
+	}
+}
+
+func (player *replayPlayer) control(control argReplayControl) error {
+	switch control.Action {
+	case "play":
+		if player.index >= len(player.cast.events) {
+			if err := player.seek(0); err != nil {
+				return err
+			}
+		}
+		player.playing = true
+	case "pause":
+		player.playing = false
+	case "speed":
+		if control.Speed > 0 {
+			player.speed = control.Speed
+		}
+	case "seek":
+		if err := player.seek(control.Position); err != nil {
+			return err
+		}
+	default:
+		player.context.logger.Warn("Unknown replay control", "action", control.Action)
+	}
+	if player.index >= len(player.cast.events) {
+		player.playing = false
+	}
+	return player.sendStatus()
+}
+
+func (player *replayPlayer) seek(position float64) error {
+	if position < player.position {
+		// Rewinding: reset the terminal and redraw from the beginning
+		player.index = 0
+		if err := player.context.sendOutput([]byte("\x1bc")); err != nil {
+			return err
+		}
+		if err := player.sendSize(player.cast.header.Width, player.cast.header.Height); err != nil {
+			return err
+		}
+	}
+	if err := player.emitUntil(position); err != nil {
+		return err
+	}
+	player.position = position
+	return nil
+}
+
+// emitUntil sends output events up to the given position in a single message,
+// split where the terminal is resized by "r" events.
+func (player *replayPlayer) emitUntil(position float64) error {
+	output := []byte{}
+	for ; player.index < len(player.cast.events); player.index++ {
+		event := player.cast.events[player.index]
+		if event.Time > position {
+			break
+		}
+		switch event.Type {
+		case "o":
+			output = append(output, event.Data...)
+		case "r":
+			var columns, rows int
+			if _, err := fmt.Sscanf(event.Data, "%dx%d", &columns, &rows); err != nil {
+				player.context.logger.Warn("Malformed resize event", "data", event.Data)
+				break
+			}
+			if len(output) > 0 {
+				if err := player.context.sendOutput(output); err != nil {
+					return err
+				}
+				output = []byte{}
+			}
+			if err := player.sendSize(columns, rows); err != nil {
+				return err
+			}
+		}
+		player.position = event.Time
+	}
+	if len(output) == 0 {
+		return nil
+	}
+	return player.context.sendOutput(output)
+}
+
+// sendSize makes the client terminal as large as the recorded one.
+func (player *replayPlayer) sendSize(columns int, rows int) error {
+	if columns <= 0 || rows <= 0 {
+		return nil
+	}
+	size, err := json.Marshal(argResizeTerminal{Columns: float64(columns), Rows: float64(rows)})
+	if err != nil {
+		return err
+	}
+	return player.context.write(append([]byte{SetTerminalSize}, size...))
+}
+
+func (player *replayPlayer) sendStatus() error {
+	status, err := json.Marshal(replayStatus{
+		Playing:  player.playing,
+		Speed:    player.speed,
+		Position: player.position,
+		Duration: player.cast.duration,
+	})
+	if err != nil {
+		return err
+	}
+	return player.context.write(append([]byte{SetReplayStatus}, status...))
+}
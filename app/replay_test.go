@@ -0,0 +1,132 @@
+package app
+
+import (
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadAsciicast(t *testing.T) {
+	cast, err := loadAsciicast(writeCastFile(t,
+		`{"version": 2, "width": 80, "height": 24}`,
+		`[0.5, "o", "hello "]`,
+		``,
+		`[1.25, "r", "120x40"]`,
+		`[2, "o", "world"]`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cast.header.Width != 80 || cast.header.Height != 24 {
+		t.Fatalf("unexpected header %+v", cast.header)
+	}
+	expected := []asciicastEvent{{0.5, "o", "hello "}, {1.25, "r", "120x40"}, {2, "o", "world"}}
+	if len(cast.events) != len(expected) {
+		t.Fatalf("expected %d events, got %v", len(expected), cast.events)
+	}
+	for i, event := range cast.events {
+		if event != expected[i] {
+			t.Errorf("expected the event %v, got %v", expected[i], event)
+		}
+	}
+	if cast.duration != 2 {
+		t.Fatalf("expected the duration 2, got %v", cast.duration)
+	}
+}
+
+func TestLoadAsciicastErrors(t *testing.T) {
+	cases := map[string][]string{
+		"empty":         {},
+		"version":       {`{"version": 1, "width": 80, "height": 24}`},
+		"header":        {`[0.5, "o", "hello"]`},
+		"event":         {`{"version": 2}`, `{"time": 0.5}`},
+		"event length":  {`{"version": 2}`, `[0.5, "o"]`},
+		"event element": {`{"version": 2}`, `["0.5", "o", "hello"]`},
+	}
+	for name, lines := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadAsciicast(writeCastFile(t, lines...)); err == nil {
+				t.Fatal("expected the file to be rejected")
+			}
+		})
+	}
+}
+
+// recordingConnection keeps the messages written to it.
+type recordingConnection struct {
+	messages  []string
+	closeOnce *sync.Once
+	closed    chan bool
+}
+
+func newRecordingConnection() *recordingConnection {
+	return &recordingConnection{closeOnce: &sync.Once{}, closed: make(chan bool)}
+}
+
+func (connection *recordingConnection) ReadMessage() (int, []byte, error) {
+	return 0, nil, io.EOF
+}
+
+func (connection *recordingConnection) WriteMessage(messageType int, data []byte) error {
+	connection.messages = append(connection.messages, string(data))
+	return nil
+}
+
+func (connection *recordingConnection) Close() error {
+	connection.closeOnce.Do(func() { close(connection.closed) })
+	return nil
+}
+
+func TestReplayResize(t *testing.T) {
+	cast, err := loadAsciicast(writeCastFile(t,
+		`{"version": 2, "width": 80, "height": 24}`,
+		`[0.5, "o", "hello "]`,
+		`[1, "r", "120x40"]`,
+		`[1.5, "o", "world"]`,
+		`[2, "r", "wide"]`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection := newRecordingConnection()
+	player := &replayPlayer{
+		context: &clientContext{
+			logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+			connection: connection,
+			writeMutex: &sync.Mutex{},
+			binary:     true,
+		},
+		cast:  cast,
+		speed: 1,
+	}
+
+	if err := player.emitUntil(2); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"0hello ", `9{"Columns":120,"Rows":40}`, "0world"}
+	if strings.Join(connection.messages, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected the messages %q, got %q", expected, connection.messages)
+	}
+
+	// Rewinding restores the size of the header
+	connection.messages = nil
+	if err := player.seek(0.5); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"0\x1bc", `9{"Columns":80,"Rows":24}`, "0hello "}
+	if strings.Join(connection.messages, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected the messages %q, got %q", expected, connection.messages)
+	}
+}
+
+func writeCastFile(t *testing.T, lines ...string) string {
+	file := filepath.Join(t.TempDir(), "test.cast")
+	if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
@@ -91,7 +91,7 @@ func staticFaviconPng() (*asset, error) {
 	return a, nil
 }
 
-var _staticIndexHtml = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x84\x90\xc1\x52\xc3\x20\x10\x86\xef\x3e\xc5\x8a\xe3\xcd\x09\xf1\xda\x90\x5c\x7d\x81\x5e\x3c\x39\x34\x6c\xc3\xb6\x04\x32\xb0\xad\x66\x1c\xdf\x5d\x28\xe6\xa4\x33\x9e\xf8\x77\xf7\x9b\xe5\x03\x75\x6f\xc2\xc8\xeb\x82\x60\x79\x76\xc3\x9d\xaa\x07\x80\xb2\xa8\x4d\x09\x39\x32\xb1\xc3\xe1\x25\xec\xf7\xaf\x4a\xd6\xa2\x0e\x12\xaf\x39\x1f\x82\x59\x9f\xe0\x81\x31\xce\xe4\xb5\x83\xcf\x25\x24\x62\x0a\x7e\x07\xfa\x90\x82\xbb\x30\x76\x60\x91\x26\xcb\x3b\x78\x6e\xdb\xc7\x0e\xde\xc9\xb0\xdd\x8a\x59\xc7\x89\x32\xdc\x2e\x1f\xdd\x97\x92\x75\x69\xbd\xc0\x91\x3f\x43\x44\xd7\x0b\x1a\x83\x17\x50\x4c\x73\x9e\xf5\x84\x72\xf1\x93\x00\x1b\xf1\xd8\x8b\xa3\xbe\x96\x79\x53\x5a\x37\x79\xb9\xd9\xab\x22\xf7\xb3\xcc\xd0\x15\xc8\xf4\x62\x13\x15\x83\x92\xb9\xb7\xbd\x65\x8c\xb4\x30\xa4\x38\xf6\xa2\x91\xa7\x24\x6d\xe1\x9a\x53\x2a\x58\x1d\xfe\x49\xea\x0b\xdb\x37\x0e\x67\xf4\xff\xb3\x79\xeb\x14\x98\xd7\x5f\xa4\x92\xd5\x33\x8b\xdf\xfe\xff\x3b\x00\x00\xff\xff\x35\xaf\x3e\x6a\x97\x01\x00\x00")
+var _staticIndexHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x75\x90\xb1\x72\xc3\x20\x0c\x86\xf7\x3e\x85\x4a\xaf\x5b\xcf\xb8\x6b\x8c\xbd\xf6\x05\xb2\x74\x24\x86\x80\x52\x0c\x1c\xa8\x69\x7d\xbd\xbc\x7b\x20\xc4\x53\xae\x13\xbf\xf4\xff\x27\x7d\x42\x3c\xab\x30\xd3\x1a\x35\x58\x5a\xdc\xf4\x24\xda\x03\x20\xac\x96\xaa\x8a\x22\x09\xc9\xe9\xe9\x23\xec\xf7\x9f\x82\xb7\xa2\x19\x99\xd6\xa2\x0f\x41\xad\x6f\xf0\x42\x3a\x2d\xe8\xa5\x83\xbf\x18\x32\x12\x06\xbf\x03\x79\xc8\xc1\x7d\x93\x1e\xc0\x6a\x34\x96\x76\xf0\xde\xf7\xaf\x03\xfc\xa0\x22\xbb\x15\x8b\x4c\x06\x4b\xb8\x8f\xbf\xc3\x45\xf0\x36\xb4\x2d\x70\xe8\xbf\x20\x69\x37\x32\x9c\x83\x67\x50\x49\x8b\x5e\xa4\xd1\x3c\x7a\xc3\xc0\x26\x7d\x1c\xd9\x51\x9e\xab\xdf\xd5\xd6\x0d\x9e\x6f\xf4\xa2\xc2\xdd\x87\x29\x3c\x03\xaa\x91\x6d\xa0\x6c\x12\xbc\xf4\xb6\x5b\xe6\x84\x91\x20\xa7\x79\x64\x1d\x3f\x65\x6e\x6b\xae\x3b\xe5\x1a\x6b\xe6\x7f\x49\x13\x88\xd6\x87\xa4\xe0\x6d\x77\x81\xb9\xfd\xe9\x15\x96\x39\xb4\x53\x6b\x01\x00\x00")
 
 func staticIndexHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -106,12 +106,12 @@ func staticIndexHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "static/index.html", size: 407, mode: os.FileMode(436), modTime: time.Unix(1444190539, 0)}
+	info := bindataFileInfo{name: "static/index.html", size: 363, mode: os.FileMode(436), modTime: time.Unix(1792312413, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _staticJsGottyJs = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x94\x56\x4f\x6f\xdb\x36\x14\xbf\xe7\x53\x10\xba\x84\xda\x5c\xc5\x6e\x77\x18\x6c\x64\x43\x57\x64\x40\xb7\x61\x29\x6a\x6f\x39\x04\x41\x41\x4b\xcf\x96\x16\x9a\x14\x48\x2a\x82\x57\xe8\xbb\xf7\x3d\x49\x96\x65\x99\xaa\x5b\x1e\x12\x99\xef\xdf\xef\xfd\x27\xdf\x14\x2a\x76\x99\x56\x3c\x64\x9f\xaf\x18\x9e\x17\x61\x58\xea\x5c\x6e\xef\x94\x58\x4b\x48\xd8\x2d\x2b\x33\x95\xe8\x32\x92\x3a\x16\xc4\x1a\xe5\x46\x3b\x1d\x6b\xc9\x6e\x6f\x59\x50\xf3\xce\x83\x45\x27\x2c\xcc\xd6\x7a\x84\x2c\x08\x13\xa7\x47\xb6\xc2\xa0\x3c\xe3\x27\xa6\x7e\x65\xd7\xa5\xb5\xf3\x9b\x9b\x6b\x36\xa7\x4f\xfa\x0a\xd9\x8f\x67\xba\x52\x6d\x9d\xe7\x3a\x17\x2e\x55\x62\x07\x48\x42\xe1\xeb\xa3\xad\x03\x60\xc2\xf5\x18\x6c\xb5\x73\xfb\xe0\xa9\x87\xb8\x70\xfa\x23\xc4\x5a\x29\x88\x1d\xb2\xbc\x9a\x2d\xae\x3a\xa2\xce\x41\x3d\x90\xe0\x59\xa4\x0e\x1c\x25\x51\x15\x94\xec\x01\xd6\x4b\x1d\x3f\x83\xe3\xe8\xdc\xe4\x68\x35\x6c\xd5\x1d\x04\x1c\x98\xdd\xe0\x2a\xcf\xd4\x76\x95\xed\xc0\xf4\xee\x4b\x1b\x69\x45\xe6\xfb\xc6\xe1\x05\x94\xeb\x23\x68\x39\x2d\xa8\x84\xff\xb1\xbc\xff\x3b\xb2\xce\xa0\xb2\x6c\xb3\xe7\x9f\xd9\x5b\xb3\x2d\x76\x28\x60\xe7\x75\x5a\x26\xec\x6d\xe1\xd2\x95\x7e\x06\x35\x67\x75\x18\x3e\xa1\xef\xe9\x27\x47\x37\x93\x2a\x0c\x17\x27\x6a\x3b\x50\x08\xc0\x82\x7b\xaf\x10\xf8\x8b\x90\x9c\x6c\x7d\x40\xda\x84\xbd\x99\xb2\x1f\xd8\x6c\x3a\x9d\x4e\x10\x43\xdf\x4d\x3a\x29\xf9\x19\x25\xb0\x11\x85\x74\x4b\xa7\x8d\xd8\x42\x1b\x29\x99\xad\xa3\xf6\x26\xfa\x0b\xd3\x27\xf9\xc0\xb4\x4f\x36\x8a\x25\xd6\x10\x1f\x9a\x21\xce\x56\x6d\x23\xb5\xc2\x3f\x99\x6a\x74\x9e\x71\x46\x5b\x70\x1f\x0c\x6c\x2c\x0f\x31\x66\x8e\x07\xe4\xcc\x2b\x50\xb1\x4e\xd0\xa3\x60\xc2\x02\x23\xca\xc0\x2b\xa9\xd5\x41\xf3\x47\x10\xc9\x7e\xac\x24\xfa\x69\xcd\x34\x72\xd5\xc2\x99\x8e\xf2\xc2\xa6\x67\x98\xe8\x20\x4d\xab\x7f\x57\x7f\xc2\x1e\x73\x87\xa9\xe8\x6b\xc6\x1b\x9f\xf2\x7e\xd6\x83\x69\x80\x15\x4f\x8c\x8b\x33\xbe\xca\x6f\x8e\xe4\x96\x75\x9d\xa0\xad\xa1\xf9\x31\x84\x47\xef\x6d\xf6\xff\x09\x48\x2c\xf2\x62\xa7\xb0\xbc\x8c\xc6\x32\xb8\x00\xd7\x4b\xa4\x13\xbc\x26\x3f\x06\x35\x3c\xca\x4d\xc7\x6f\xa8\x7f\x5a\x64\xf3\xc3\xc7\xe4\xa2\x04\xb9\x30\xaf\xff\x7e\x9d\xb7\x1a\xa5\x86\x5e\xca\xf9\xad\x2f\x37\x4d\xad\x28\xeb\x84\x94\x98\x90\xb5\x16\x26\x19\xf6\xc6\x50\xae\x6d\x95\x18\x9b\xc4\x01\x4f\x74\x5c\xb7\x3c\x15\xfa\x9d\x04\xfa\xfc\x6d\xff\x1e\xab\xc4\xb5\xe9\x0b\xfa\x6d\x5e\x0d\xe7\xcd\x0e\xac\x6d\xfa\xf4\xeb\x23\x27\x11\x4e\x20\x53\x4d\x8b\xe8\x47\x64\x65\x16\x03\x9f\x0d\xc0\xda\x32\x73\x71\xca\x8f\x7c\x8f\xd3\xa7\xa1\xae\x58\x58\x60\xd7\xd3\xeb\xf9\x48\x38\x74\x54\x9a\xcc\xc1\x3f\xab\xdf\x7f\xe6\xed\xcc\x17\x4e\xaf\x39\xa9\x1b\xce\x2c\x3a\x6b\x03\xe2\x79\xe1\x31\x31\xf3\x98\xb8\xb9\x61\xb9\x56\xdb\x6f\x57\xf2\x7a\x0c\x27\x8e\x93\x87\x1a\xdd\x2a\x73\x12\x1a\x74\xdf\x01\xee\x8d\x47\x6f\x8e\x93\x0a\x0c\x4e\x27\xa0\x1d\x53\xb7\x46\x2e\x8c\x1d\x55\x7e\xbf\xfe\x0f\x57\x58\xf4\x8c\xad\xcc\x7b\xb2\x61\xb4\xd1\xe6\x4e\x60\x1e\xba\xa4\x22\xcb\x58\xa3\xe2\x22\xb4\x5a\x02\xee\xd5\x2d\x0f\x96\xe0\x1c\x8d\x09\x6a\x4d\x94\xc1\xbf\xc1\xbc\xfe\xd1\xc7\xf6\x88\x94\x27\x0f\x9c\x2e\x34\x83\xa1\x8b\xec\x93\x6f\x91\xaf\xbe\x27\x7e\x3f\x79\xe2\x37\xdc\xec\x97\x23\x78\xe2\x7c\xfd\x2e\x21\xef\xcd\x41\x47\xe3\xfb\xa9\x5a\x0c\x09\xae\x47\xfc\x95\xd8\xe0\xbc\xcb\x3d\x78\xab\xf1\xf6\x8b\xa5\xb6\x97\x9b\x2f\xdb\x30\x4e\x71\xf5\x65\xb0\x8e\x77\xa1\x2e\xcc\x90\x8e\x93\x96\x41\xaa\xcb\xfb\x17\x30\x52\xec\x79\xf0\xae\x71\x0a\x4d\xb3\x77\x84\x25\xc1\x95\xa8\x0a\x29\x87\x33\xe8\x34\x01\xb4\x98\xbb\xe7\x41\xf7\x6c\x18\xc8\x10\xea\xd3\xc8\xfd\xc2\xa6\x3e\x17\xb0\x44\x48\x5e\x17\x8e\x37\xaf\xaf\xc9\x20\xe2\xcd\x9b\x63\x14\x52\xd5\x10\xaa\xab\xe3\x2b\xee\xf0\x64\xe9\x87\xf6\x74\x55\x75\xdb\x74\x16\x84\x9d\x3c\xfd\x6b\x20\x50\x00\xab\x90\x87\x57\x5f\x02\x00\x00\xff\xff\x9e\x90\xaa\xec\x32\x0b\x00\x00")
+var _staticJsGottyJs = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x95\x19\xfd\x6f\xdb\x36\xf6\xf7\xfc\x15\xac\x80\xa1\xd2\xcd\x51\x9d\xf4\xe3\x32\xfb\x72\x43\x97\xa6\xb7\x6e\xed\xb5\x48\xd2\xeb\x01\x45\x71\xa0\x25\xda\xd6\x22\x93\x1a\x49\xd5\xf5\x0a\xff\xef\xf7\x1e\x29\x4b\x94\x44\x29\x89\x81\x36\x0e\xf9\xf8\xbe\xbf\x13\x2e\x4b\x9e\xe8\x4c\xf0\x30\x22\xdf\x8f\x08\x7c\xbe\x52\x49\xd6\x5a\x17\xea\x92\xd3\x45\xce\x52\x72\x4e\xb6\x19\x4f\xc5\x36\xce\x45\x42\x11\x34\x2e\xa4\xd0\x22\x11\x39\x39\x3f\x27\x81\x81\x9d\x05\xf3\xfa\x31\x95\x2b\xe5\x79\xa4\x18\x95\xc9\xba\x01\x2b\x25\xbc\x27\x61\x8b\xd4\xcf\xe4\xf1\x56\xa9\xd9\x93\x27\x8f\xc9\x0c\xbf\xe2\xb7\x88\xfc\xd8\xc3\xb5\x16\x4a\x7b\x8e\x0b\xaa\xd7\x9c\x6e\x18\x5c\xc1\xe3\xc7\x0d\xad\x03\xc3\xc8\xd7\xe7\x60\x25\xb4\xde\xc5\x8b\x8c\x53\xb9\x0b\x26\xc4\xfe\x1e\x7c\x71\x24\x28\xb5\xb8\x62\x89\xe0\x9c\x25\x1a\x9e\x1c\x9f\x34\x77\x8a\x29\x05\xb4\xde\xbc\x82\xf3\xc0\x91\x5a\xb2\x22\xa7\xbb\x0b\xc1\xb5\x04\x3a\xf3\xa3\xfa\x42\x14\x8c\x7f\x42\xc2\x3d\x4d\xe3\x67\xc9\x74\xb2\x7e\x59\xea\xf5\x8d\xb8\x65\x3c\xac\x68\x46\x16\xef\xde\x41\xd3\x70\x53\xe3\xa1\x87\x67\x2e\x42\x84\xdd\x22\x39\xce\xb6\xe4\x13\x5b\x5c\x8b\xe4\x96\xe9\x10\xb4\x3d\x69\xd4\x50\xe1\xc7\xcf\x56\x55\x9a\xb8\xd9\x15\x0c\x65\xa2\x52\xd2\xdd\xa2\x5c\x2e\x99\x0c\x2a\xfa\x07\xbc\x9a\xc9\x4d\xe7\xa8\xc8\xf8\xea\x26\xdb\x30\xe9\x9c\x3f\x79\x42\xae\x99\x26\xdb\x35\xe3\x44\xaf\x19\xb0\xbe\xd9\x50\x9e\x12\xf6\x2d\xd3\x8a\x2c\xd8\x52\x48\x56\x5d\x18\x99\x40\x16\x92\x29\x92\xe4\x42\xb1\xb4\x85\x1d\x5f\x5c\x6b\xaa\x4b\xe5\xa0\x07\x8e\x05\x47\xad\xba\xba\x60\x5f\x19\xd7\xae\x1e\x2a\x48\xc5\x78\x1a\xfe\x76\xfd\xfe\xdf\xb1\xd2\x12\x78\xcd\x96\xbb\xf0\x3b\x79\x29\x57\xe5\x06\x1e\xa8\x99\xf1\xd6\x09\xa9\x2d\x30\x23\xb5\x56\x27\x20\x45\x65\xeb\x59\x63\xf6\xc9\x3e\x72\xb4\x87\x9f\x5a\x05\xc0\x8f\x62\xfa\x0d\x07\x35\x7d\xa5\x79\x88\xa4\x3f\xc0\xdd\x84\x3c\x9d\x92\xbf\x91\x93\xe9\x74\x3a\x01\x96\x22\x47\x14\xfc\xac\x51\xab\x71\xca\x96\xb4\xcc\x41\x58\x21\xe9\x8a\x55\xe6\xcb\xb3\x45\x5c\x9d\xc4\x6f\xc1\xc9\xf3\xb0\x43\xda\xf7\x36\x4e\x72\x88\xb4\xb0\x4b\x06\x21\x2b\xb4\xf6\xd5\x0d\xfc\x07\x86\xcf\xbd\x90\xf1\x8a\xe9\x0f\x92\x2d\x55\x18\x81\x0a\x75\x18\xa0\x30\xc7\x8c\x27\x22\x05\x89\x30\x68\x24\xdd\x06\xde\x97\x82\x1f\x30\x5f\x31\x9a\xee\x86\x1c\xdf\x35\x73\x26\x00\xca\x3c\xce\x44\x5c\x94\x6a\xdd\xe3\x09\x3f\x70\x27\xf8\x7f\x6e\x7e\x67\x3b\x30\x25\x18\xc8\xc5\x0c\x27\x3e\xe4\xae\x13\x04\xd3\x00\xf2\x02\x02\xce\x7b\x70\x7b\x3f\x39\x7c\x77\x6d\xdc\x06\x68\x75\xc9\x0f\x71\xd8\x48\xaf\xb2\xbf\x5a\x4c\x42\xe4\x95\x1b\x0e\xde\x26\x05\xb8\xc1\x1d\xec\x7a\x2f\xf1\x13\x9c\xa2\x1c\x1d\x97\x1e\x84\xc6\xcf\xf7\xd1\x5b\xfc\x54\x9c\xcd\x0e\x5f\x26\x77\xbe\x40\x11\x66\xe6\xff\x71\xd8\xfd\xe0\x6d\x74\x74\xbf\x53\x9f\x6d\xac\xaf\x70\xa5\x69\x9e\x83\x41\x16\x82\xca\xb4\x1b\x1b\x7b\x9f\x73\xa6\x90\xd5\x25\xd5\x2c\x4c\x45\x62\x32\x00\x3a\xfa\x65\xce\xf0\xeb\x2f\xbb\x37\xe0\x25\xba\x32\x5f\xe0\x86\xf9\xbe\x9b\x7e\x36\x90\x0e\x6c\x9c\x8e\x67\x20\x93\x35\x21\xb1\xce\x7b\xa7\x29\xd5\xb4\x7d\x9a\x2d\x89\x45\x12\xe3\x1d\x31\xe2\xf1\x84\x89\x25\xa4\x2b\x48\xc9\xbf\x98\x94\xec\x73\x1b\xc8\xb7\x6e\x49\x83\x14\x66\x68\x92\xc5\x4e\x33\xb2\x14\x79\x2e\xb6\x50\x5b\x17\x3b\x93\x73\x21\x6e\x49\x41\x77\xb9\xa0\xa9\x37\x16\xf1\xd1\xa1\x7c\x7c\xcc\xb8\x3e\x33\xc4\x1d\xc6\x3c\xe1\xa3\x6d\xe9\xb0\xa1\x12\x2f\xa5\xd8\x5c\xac\xa9\xbc\x10\x29\x0b\x0d\xba\xcf\xd3\x2f\x9e\x57\x46\xca\x73\x4b\xf0\x46\xd8\xc7\x16\x3e\x56\xe5\xc2\x94\xa1\xf0\x24\xf2\x3c\x44\x45\x19\x92\x8f\xce\xc9\xe3\xe9\xe3\xa1\x48\xaa\xf0\xa3\xc9\x53\xf6\xf1\xea\xcd\x85\xd8\x14\x82\x83\x18\x21\x53\x09\x2d\xc0\x07\x50\x1a\x5f\x36\x68\xfb\x11\x61\xb9\x62\x1e\x1a\x95\xd4\x8d\x66\x40\xcc\x41\x29\x1b\xa8\x58\xe5\x59\xc2\x40\xb2\x11\xc1\xce\xef\x23\x58\xd5\xfd\x50\x2d\x16\xe1\x80\x61\x3a\x92\xb4\x03\x42\x6d\x33\xe8\x3d\x0c\xc1\x2e\xa5\x84\x82\xc4\xc0\xc1\x6c\x20\xf2\x44\xbc\x95\x99\x66\x1f\x6f\x5e\x9f\x0d\x91\x5e\x48\x46\x6f\xe7\x1e\xac\x27\x1e\xac\xe0\xc1\x60\x9a\xd5\xfd\x91\x9c\x0e\xb1\x06\xc5\xea\x93\xd1\xcb\x4d\xa6\x73\xf6\x60\xe6\x9e\x7a\xf0\x16\x50\x07\x99\x84\xda\x67\xe2\xc2\x24\xde\x82\x4a\x35\x88\xfc\xfd\xe2\x0f\x68\x6a\xe2\x5b\x28\x14\xa1\xf3\x36\x8a\xa1\xef\xb9\xa4\xa0\xf1\x3a\x65\x00\xc8\x90\x8d\xa1\x35\x52\x22\x67\xd0\xdb\xae\xc2\x00\xba\x29\x8d\x45\x08\x13\x3f\xbc\x81\xff\x83\x99\xf9\xc5\xe5\xed\x33\xdc\xf8\xc2\x6c\xa8\xa4\x03\xf8\xe4\x3e\xef\xf7\x0f\xd1\xdf\x33\x8f\xfe\xba\xdd\xf4\xdd\x1a\x6c\x09\x6f\x66\x03\x94\x5e\x1e\x70\x58\xd9\xdb\x68\x41\x25\xd0\x7c\xc1\x6f\xa9\x0a\xa2\xfb\xf3\xfb\xdc\xc3\x2f\x46\xe1\xa3\x76\x3b\x3f\x64\xa5\x36\x14\xc8\x96\x00\x21\xcd\xae\x5a\xc7\xe1\x9d\x81\xd9\x47\x15\x97\x45\x8a\x65\x0a\xca\x6b\x4f\x5f\x0f\xb1\xc7\x0b\x7f\xb0\x5d\x43\x32\x22\x0b\x9a\xdc\x12\x68\xbd\x6b\xbd\x62\x1f\xae\x05\x41\x11\x34\xf8\x29\x7e\xc7\x8a\xa1\x70\xa2\x82\xd1\x01\x7c\x44\xf5\x90\xb9\xe3\x50\xbf\xa4\x8d\xf2\xf6\xf7\x91\xf4\xa2\xd6\x62\xfb\xfe\x2b\x93\xa0\x12\x23\xf4\xc4\xb4\xcf\xd3\x87\x88\x7e\xe6\x41\xdf\xcc\x13\x0f\xf7\xc3\x0b\x67\x8a\x61\xa9\xf5\xc1\x87\xa6\x97\x9f\xfc\xe6\xb0\xfe\xa2\x40\xf3\xa6\x65\x44\xa5\x1f\xda\x10\x42\x95\x31\x90\x4c\x99\xbf\x5e\x57\x4d\xe6\xdd\xc2\x34\xe9\x31\xd5\xeb\x10\x9f\xc5\x17\xb6\xdb\x1b\x01\xfe\x95\x65\xab\xb5\xb6\xd0\x57\x62\xab\xee\x27\xec\x7e\xb8\x71\x32\x43\xde\x9d\x6d\x93\x29\x84\xc0\x82\x2f\xee\x0c\x6b\x25\xbf\xa3\xfb\x1b\x72\x26\xb4\xde\x3b\xdb\xbc\x85\x8d\x37\x44\x13\xc2\xcb\x3c\x8f\x86\xc4\x30\x16\xc4\xb1\xaa\x1e\xee\xea\xa1\x2f\xea\x37\x71\xed\xcc\xf4\x4f\x32\xf5\x89\x01\xca\xc5\xf7\xa2\xd4\xa1\xdd\x10\x4c\x3a\x19\xcd\x4e\x8c\xd1\x88\x66\xab\x9a\x7e\xe4\x4e\xcb\xef\x3c\x8d\x69\x23\xa6\xc3\x87\xc9\x72\xfe\x2b\x9b\x8e\x74\x29\x39\x01\xaf\xaf\x53\xc3\x85\x99\xcf\x03\xa7\x2b\x6e\x21\x6b\x70\xc5\xd7\xd9\x0a\x5d\xd7\x23\x79\x83\xd6\x06\xd3\xef\x59\x9e\xdb\xde\xb4\x7a\x83\x51\xd5\xc3\xe4\x23\xd9\xc5\x74\x69\xc2\x12\x9a\x22\xbd\x26\xd8\x79\x76\x31\xe1\x59\x7b\xab\x02\x81\x07\xd2\x81\x5f\xe0\x52\xc2\x74\xbd\xd0\xee\x0a\x68\x9e\xed\x58\x45\xa0\xf1\x4e\xd6\x66\xf3\x92\xc2\xdd\xf4\xf8\xf4\xf9\xf3\x09\x86\xa3\x19\x9f\x01\x75\x01\x7a\x51\xd0\x5f\x4b\x02\x7d\xd0\xf1\x19\xbc\x2e\x4a\x7d\xd4\xea\xa3\x0f\x6d\xad\x6b\x0e\x73\xd1\xdd\xd8\x24\xeb\x92\xdf\x9a\xed\x94\xd3\x42\x22\xea\xd0\xcc\xc7\x70\x31\x9d\xc3\x8f\x7f\x58\xb4\x71\xce\xf8\x4a\xaf\xf1\xe4\xc7\x73\x72\x76\xf2\xd3\x69\xaf\x81\x33\xf8\xec\x2c\xed\x69\xcb\x63\x5a\x14\xf9\x2e\x44\x9f\x9f\x90\x4e\xcb\x9d\x4d\x10\xad\xc5\xda\x9a\x81\xba\xaa\xaf\x68\xfc\x21\x32\x1e\x06\x41\xd4\x53\xee\x6b\x5c\x6d\x81\xe6\x40\xa1\x40\x3f\x67\xa4\x84\xc8\xd7\xb8\x59\xc1\xca\x82\x6b\x16\x88\xfc\x2c\x81\x32\x07\x20\x38\x6e\x38\x65\x08\xcd\x58\xab\xb2\xbd\x23\x6b\x4d\xd4\x90\x01\xb0\x8c\x75\xd5\xf9\x6d\x2d\xab\x11\xe6\xbf\xef\xde\xfe\xaa\x75\x71\xc5\xfe\x2c\x99\xd2\x6e\x96\x00\x98\x18\x23\x2f\x0c\xfe\x75\x79\x13\x4c\xc6\x96\x89\x01\x32\xfb\x3f\xc3\x7a\xd0\xc5\xc0\x71\x92\x1a\x5b\x72\x1c\x78\x0c\x11\x5c\x55\xc5\xe7\x9c\x9c\x4e\xa7\xe4\x67\x37\x6d\xe3\x35\x14\x00\xe8\x83\x15\xbb\x61\xdf\x74\x14\x5b\x71\xa1\xd2\x04\xed\x51\xb4\x4d\x9f\x49\x29\xe4\xbd\x18\x18\xc3\x63\x76\x0e\x9e\xb5\xe3\x61\x89\xe5\x12\x68\x2f\x2f\xea\xfd\xca\x49\xed\x03\xce\xd6\xd2\xd3\x0f\x0d\xf1\x6a\x37\x97\xf3\xd6\xef\xaa\x5a\xfe\xb9\x67\xb6\x35\x4a\x5f\xea\x0e\x28\x63\xb7\x15\xa3\x14\x06\xb6\xce\x9e\x12\x59\x6c\xef\x62\x0c\x33\x43\x1b\xc3\xe0\xa9\x67\xc9\x72\x78\x33\xb0\x18\x30\xae\x2a\xe4\x86\x9a\xc4\xde\xda\x4e\xd9\xc6\xb4\x4b\xac\x3a\x06\xc8\x77\xe0\x6b\xf1\x32\x17\x42\xd6\xb0\xfd\x8d\x81\x32\xfb\x45\xfb\xe4\x07\xf2\x62\x3a\xf7\x65\xd6\x3e\x26\xf2\x04\x60\x23\x33\x33\xa0\x4c\xa1\x82\x2c\x72\x82\xbe\x87\x0b\x31\xe3\x5c\xb8\x16\x1b\x16\x09\xd2\x02\xf6\x76\x87\x7d\x89\xb5\x68\xb5\x32\x09\x83\x34\xfb\xea\x7a\x15\x00\x83\xc2\x76\xd0\x33\x25\x4a\xa1\x17\xe3\x46\xb9\x10\x2a\x43\x3d\xcc\x08\x5d\x40\x3f\x55\x6a\x36\x27\x39\x5b\x42\x1f\x3f\x2d\xbe\xcd\x89\xc4\x16\xa3\xfa\xbe\x10\x5a\x8b\x4d\xf5\xcb\x9a\xd9\x9b\xd3\x33\xfc\x0d\x98\x6f\x09\x0c\xa4\x15\xba\xd5\x8c\x2c\x73\x06\xf7\x34\x87\x5a\x71\x0c\x45\x60\x83\x7b\x2c\x86\x85\x7a\x4e\x0a\x9a\xe2\xc2\xd2\x20\x24\x7e\x34\x18\x1a\x2b\x29\x4a\x0e\x3d\x9d\x5c\x2d\xc2\xa7\xa7\x13\x62\xff\x45\x73\xdc\x87\x09\x69\xcf\x4f\x9f\x4d\x27\xe4\xf0\x1f\x5c\x2d\xc1\x1b\x66\xe4\xe4\x14\x10\x6f\x04\x17\xaa\xa0\x09\x9b\x77\x37\xe6\x8b\x12\xe4\xe1\x23\xfa\xb3\x00\x2d\x15\x9a\x93\x4a\x8b\x5b\x6c\xd6\x50\x87\x2f\x40\x80\xa0\x07\x84\xfd\x54\x06\x5d\xfc\x48\xf4\x1b\x77\xfe\x4e\x5e\x26\xd6\x02\x36\xa0\xe2\x0f\xa0\x38\x0c\x16\xf0\x82\x82\x42\x5e\x36\x9e\x80\xda\x0c\x5a\xf3\xde\xbe\x17\x45\xec\x76\x44\x18\x53\x01\x5d\x59\x10\x3e\xae\xf6\x24\x81\xa4\x7c\xc5\x82\xce\x25\x34\xb9\xa6\xb8\xb5\x4f\x95\x66\x05\x1e\xc7\x27\xbd\x8b\x8e\x6f\xa1\xed\xc1\x0a\x73\xb2\xa1\x72\x95\xf1\xc6\xd0\x5d\x42\x82\x6f\x04\x08\x0a\x29\x9e\x77\xd4\xe5\x64\x0e\x2d\x4b\xf0\xcd\x7d\xef\x29\xf4\x01\xbc\xdd\x54\xf5\xd5\xdc\xc9\x3e\x23\x36\x08\x10\x18\x2a\xce\x87\x3a\x2e\x4c\x05\x78\x0d\x95\x04\x5a\x6d\xa4\x08\x1d\x66\xc9\xa2\x51\x53\x68\x9b\x63\x86\x4c\x01\xee\xc8\x5b\xfb\x79\x63\xbe\x82\x99\xbf\xe7\x0d\x3e\x62\x39\xd4\xdf\x96\x01\xf1\x45\xa5\x75\xab\xe1\xb7\x10\xb8\xa8\xf8\xb3\x96\x3f\x7e\x9e\xc6\xd0\x1c\x9d\x40\x6c\x4c\xc8\xb3\x09\x39\xfb\xd2\x5f\x76\x54\x32\xf5\xf7\xa3\xa2\x30\x25\x7f\x98\x2d\x0b\x10\x74\x52\xa2\x3d\xb5\xaa\x82\xc7\xe6\xa7\x17\x42\x5b\x57\xb1\x80\x90\x06\x5d\xbe\x1b\x19\xa1\x23\x02\x2b\x5d\xac\xb3\x3c\x0d\xed\x43\x57\xf9\x3d\x95\xdc\xcf\x27\x3a\x66\xc7\x97\x60\xf7\x6b\xfc\xd9\x36\xba\xc1\x79\x87\xd5\x31\xb7\xba\x5c\xda\x1c\xd0\x49\xbe\x2e\x00\xba\xd2\xc8\x35\x7a\xd0\xd8\x6b\xe4\xc9\xb9\xaf\xad\xb3\x10\xe9\xae\xcd\x08\x95\x3e\xb8\xe1\xcd\x7a\xe5\x50\x36\xbf\xa3\x33\x41\x8b\x92\x84\x30\xee\xfc\x40\x8e\x4d\xb6\x8f\xba\x79\x54\x02\x31\x36\xda\xe5\x98\x3f\x46\x56\x01\x85\x85\xb2\xca\x73\xd5\x49\x7f\x48\x6b\x27\x42\xdf\x84\x56\x63\x83\x1e\x3b\x7c\x05\x0e\x19\x73\xb1\x05\xba\xc7\x4d\x07\x12\x41\x71\xc5\x29\x0d\x86\xb5\x0a\x9f\xb1\xed\xd8\x18\xe9\xf0\x68\x6a\x35\xa8\x24\x3c\x9c\x4d\x0e\x58\x5e\x95\x92\x76\x5c\xd0\xc9\xfa\xe8\xd0\xd8\x4c\xe1\x12\xe7\xdc\x93\xd1\x3f\xd4\x19\x1d\x0f\xbb\xde\x6e\xb2\x2e\xfd\xd6\xbc\x3c\x10\xeb\xeb\xe8\x51\x95\xd5\xfc\xf3\xeb\x21\x4f\x01\xa6\xc2\xab\xe6\xb6\xe0\xe8\x6e\x1d\xd6\x9b\x6e\xa9\x56\x81\x69\x54\x40\xab\xd8\xaa\x38\xd7\xe3\x7a\x71\xc2\xa7\x11\xab\x63\x09\x37\x92\xdc\xbf\xd2\x0e\x3a\x54\xe3\x24\x3e\xf1\xad\x43\x86\xc3\xe3\x39\xa4\xc2\xe7\x53\x37\x01\x57\x0d\x5a\x1b\x95\xf5\xa4\x59\xe3\xd6\x30\xb3\xe0\x2a\x00\x7e\x5c\x0f\xd2\x3e\xfc\x79\xff\x93\xea\xef\x3c\x0e\x03\x46\x83\xa1\x0f\x53\xbb\x2f\x80\x35\x7e\x3d\x7f\xb8\x8c\xed\x71\xc1\xae\x31\x10\x7c\x1f\x85\xd1\xd1\xff\x01\xb7\xdc\xd0\xeb\x5a\x22\x00\x00")
 
 func staticJsGottyJsBytes() ([]byte, error) {
 	return bindataRead(
@@ -126,7 +126,7 @@ func staticJsGottyJs() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "static/js/gotty.js", size: 2866, mode: os.FileMode(436), modTime: time.Unix(1444190539, 0)}
+	info := bindataFileInfo{name: "static/js/gotty.js", size: 8794, mode: os.FileMode(436), modTime: time.Unix(1792319954, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
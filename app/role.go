@@ -0,0 +1,65 @@
+package app
+
+import (
+	"errors"
+)
+
+const (
+	// Viewers can watch the terminal but their input is dropped
+	roleViewer = "viewer"
+	// Operators can also write input to the terminal
+	roleOperator = "operator"
+)
+
+// roles assigns a role to each authenticated user.
+// Users not listed in the Operators or Viewers option get the default role
+// given by the PermitWrite option of the command.
+type roles struct {
+	operators map[string]bool
+	viewers   map[string]bool
+}
+
+func newRoles(options *Options) *roles {
+	roles := &roles{
+		operators: make(map[string]bool),
+		viewers:   make(map[string]bool),
+	}
+	for _, user := range splitList(options.Operators) {
+		roles.operators[user] = true
+	}
+	for _, user := range splitList(options.Viewers) {
+		roles.viewers[user] = true
+	}
+	return roles
+}
+
+func (roles *roles) of(user string, permitWrite bool) string {
+	switch {
+	case roles.operators[user]:
+		return roleOperator
+	case roles.viewers[user]:
+		return roleViewer
+	case permitWrite:
+		return roleOperator
+	default:
+		return roleViewer
+	}
+}
+
+func checkRoles(options *Options) error {
+	if options.Operators == "" && options.Viewers == "" {
+		return nil
+	}
+	if !authenticationEnabled(options) {
+		return errors.New("Roles are given to users, but no authentication is enabled")
+	}
+	viewers := splitList(options.Viewers)
+	for _, operator := range splitList(options.Operators) {
+		for _, viewer := range viewers {
+			if operator == viewer {
+				return errors.New("User " + operator + " is both an operator and a viewer")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	cases := []struct {
+		user        string
+		permitWrite bool
+		role        string
+	}{
+		{"alice", false, roleOperator},
+		{"bob", false, roleOperator},
+		{"carol", false, roleViewer},
+		{"dave", false, roleViewer},
+		{"", false, roleViewer},
+		{"alice", true, roleOperator},
+		{"carol", true, roleViewer},
+		{"dave", true, roleOperator},
+	}
+	for _, c := range cases {
+		options := DefaultOptions
+		options.Operators = "alice, bob"
+		options.Viewers = "carol"
+		if role := newRoles(&options).of(c.user, c.permitWrite); role != c.role {
+			t.Errorf("expected %q to be %s with permit_write %v, got %s", c.user, c.role, c.permitWrite, role)
+		}
+	}
+}
+
+func TestCheckRoles(t *testing.T) {
+	cases := map[string]struct {
+		options Options
+		valid   bool
+	}{
+		"no roles":          {Options{}, true},
+		"basic auth":        {Options{EnableBasicAuth: true, Operators: "alice"}, true},
+		"htpasswd":          {Options{HtpasswdFile: "htpasswd", Viewers: "alice"}, true},
+		"token":             {Options{TokenFile: "tokens", Operators: "alice"}, true},
+		"oidc":              {Options{OIDCIssuer: "https://example.com", Operators: "alice"}, true},
+		"no authentication": {Options{Operators: "alice"}, false},
+		"both roles":        {Options{EnableBasicAuth: true, Operators: "alice, bob", Viewers: "carol,bob"}, false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := checkRoles(&c.options)
+			if c.valid && err != nil {
+				t.Fatalf("expected the roles to be valid: %s", err)
+			}
+			if !c.valid && err == nil {
+				t.Fatal("expected the roles to be rejected")
+			}
+		})
+	}
+}
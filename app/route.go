@@ -0,0 +1,166 @@
+package app
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// CommandOptions is a command served on its own path
+// in addition to the command given on the command line.
+type CommandOptions struct {
+	// Defaults to "/<name>/"
+	Path    string   `hcl:"path"`
+	Command []string `hcl:"command"`
+	// Override the options of the same names when set
+	TitleFormat    string                 `hcl:"title_format"`
+	PermitWrite    *bool                  `hcl:"permit_write"`
+	Backend        string                 `hcl:"backend"`
+	Preferences    HtermPrefernces        `hcl:"preferences"`
+	RawPreferences map[string]interface{} `hcl:"preferences"`
+}
+
+// UserOptions overrides the command given on the command line
+// for an authenticated user.
+type UserOptions struct {
+	Command []string `hcl:"command"`
+}
+
+// route is a path under which a command is served.
+type route struct {
+	// Empty for the command given on the command line
+	name    string
+	path    string
+	command []string
+
+	titleTemplate *template.Template
+	permitWrite   bool
+	// Name of the backend to run the command on
+	backend string
+
+	// nil for the command given on the command line
+	options *CommandOptions
+}
+
+// newRoutes returns the command given on the command line, if any, followed by
+// the commands in the Commands option sorted by name.
+func newRoutes(command []string, options *Options) ([]*route, error) {
+	titleTemplate, err := template.New("title").Parse(options.TitleFormat)
+	if err != nil {
+		return nil, errors.New("Title format string syntax error")
+	}
+
+	routes := []*route{}
+	if len(command) > 0 {
+		routes = append(routes, &route{
+			name:          "",
+			path:          "/",
+			command:       command,
+			titleTemplate: titleTemplate,
+			permitWrite:   options.PermitWrite,
+			backend:       options.Backend,
+		})
+	}
+
+	names := make([]string, 0, len(options.Commands))
+	for name := range options.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		commandOptions := options.Commands[name]
+		route := &route{
+			name:          name,
+			path:          commandPath(name, commandOptions),
+			command:       commandOptions.Command,
+			titleTemplate: titleTemplate,
+			permitWrite:   options.PermitWrite,
+			backend:       options.Backend,
+			options:       &commandOptions,
+		}
+		if commandOptions.TitleFormat != "" {
+			route.titleTemplate, err = template.New("title").Parse(commandOptions.TitleFormat)
+			if err != nil {
+				return nil, errors.New("Title format string syntax error in " + name)
+			}
+		}
+		if commandOptions.PermitWrite != nil {
+			route.permitWrite = *commandOptions.PermitWrite
+		}
+		if commandOptions.Backend != "" {
+			route.backend = commandOptions.Backend
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// commandFor returns the command to run for a user connecting to the route.
+func (app *App) commandFor(route *route, user string) []string {
+	if route.name == "" && user != "" {
+		if userOptions, ok := app.options.Users[user]; ok {
+			return userOptions.Command
+		}
+	}
+	return route.command
+}
+
+// routeByName returns the route of the command of the name in the Commands option,
+// or the command given on the command line for an empty name.
+func (app *App) routeByName(name string) (*route, bool) {
+	for _, route := range app.routes {
+		if route.name == name {
+			return route, true
+		}
+	}
+	return nil, false
+}
+
+// commandPath returns the path of the command with leading and trailing slashes.
+func commandPath(name string, command CommandOptions) string {
+	path := command.Path
+	if path == "" {
+		path = name
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "/"
+	}
+	return "/" + path + "/"
+}
+
+func checkRoutes(options *Options) error {
+	paths := make(map[string]string)
+	for name, command := range options.Commands {
+		if len(command.Command) == 0 {
+			return errors.New("No command given for " + name)
+		}
+		path := commandPath(name, command)
+		switch path {
+		case "/":
+			return errors.New("The path of " + name + " conflicts with the command given on the command line")
+		case "/js/", "/oidc/", "/admin/", "/metrics/":
+			return errors.New("The path of " + name + " is reserved by GoTTY")
+		}
+		if command.Backend != "" {
+			if _, err := backendFactory(command.Backend, options); err != nil {
+				return errors.New(err.Error() + " for " + name)
+			}
+		}
+		if other, ok := paths[path]; ok {
+			return errors.New(name + " and " + other + " are served on the same path " + path)
+		}
+		paths[path] = name
+	}
+	if len(options.Users) > 0 && !authenticationEnabled(options) {
+		return errors.New("Commands are given to users, but no authentication is enabled")
+	}
+	for user, userOptions := range options.Users {
+		if len(userOptions.Command) == 0 {
+			return errors.New("No command given for user " + user)
+		}
+	}
+	return nil
+}
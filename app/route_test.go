@@ -0,0 +1,114 @@
+package app
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	options := DefaultOptions
+	options.Commands = map[string]CommandOptions{
+		"top":  {Command: []string{"top"}},
+		"logs": {Path: "/var/logs", Command: []string{"tail", "-f", "log"}},
+	}
+	options.PermitWrite = true
+	options.TitleFormat = "{{ .Command }}"
+	permitWrite := false
+	options.Commands["logs"] = CommandOptions{
+		Path:        "/var/logs",
+		Command:     []string{"tail", "-f", "log"},
+		TitleFormat: "logs of {{ .Hostname }}",
+		PermitWrite: &permitWrite,
+	}
+
+	expected := []route{
+		{name: "", path: "/", command: []string{"bash"}, permitWrite: true},
+		{name: "logs", path: "/var/logs/", command: []string{"tail", "-f", "log"}, permitWrite: false},
+		{name: "top", path: "/top/", command: []string{"top"}, permitWrite: true},
+	}
+	titles := []string{"bash", "logs of host", "bash"}
+	routes, err := newRoutes([]string{"bash"}, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("expected %d routes, got %d", len(expected), len(routes))
+	}
+	for i, route := range routes {
+		if route.name != expected[i].name || route.path != expected[i].path || !reflect.DeepEqual(route.command, expected[i].command) ||
+			route.permitWrite != expected[i].permitWrite {
+			t.Errorf("expected the route %+v, got %+v", expected[i], *route)
+		}
+		title := &bytes.Buffer{}
+		route.titleTemplate.Execute(title, map[string]string{"Command": "bash", "Hostname": "host"})
+		if title.String() != titles[i] {
+			t.Errorf("expected the title %q for %s, got %q", titles[i], route.path, title)
+		}
+	}
+
+	options.Commands["top"] = CommandOptions{Command: []string{"top"}, TitleFormat: "{{ .Command"}
+	if _, err := newRoutes([]string{"bash"}, &options); err == nil {
+		t.Fatal("expected an invalid title format to be rejected")
+	}
+}
+
+func TestCommandFor(t *testing.T) {
+	options := DefaultOptions
+	options.Commands = map[string]CommandOptions{"top": {Command: []string{"top"}}}
+	options.Users = map[string]UserOptions{"alice": {Command: []string{"ssh", "alice@host"}}}
+	app := &App{command: []string{"bash"}, options: &options}
+	main := &route{name: "", path: "/", command: []string{"bash"}}
+	top := &route{name: "top", path: "/top/", command: []string{"top"}}
+
+	cases := []struct {
+		route   *route
+		user    string
+		command []string
+	}{
+		{main, "alice", []string{"ssh", "alice@host"}},
+		{main, "bob", []string{"bash"}},
+		{main, "", []string{"bash"}},
+		{top, "alice", []string{"top"}},
+	}
+	for _, c := range cases {
+		if command := app.commandFor(c.route, c.user); !reflect.DeepEqual(command, c.command) {
+			t.Errorf("expected %v for %q on %s, got %v", c.command, c.user, c.route.path, command)
+		}
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	command := []string{"top"}
+	cases := map[string]struct {
+		commands map[string]CommandOptions
+		users    map[string]UserOptions
+		auth     bool
+		valid    bool
+	}{
+		"commands":           {map[string]CommandOptions{"top": {Command: command}, "htop": {Path: "/h/", Command: command}}, nil, true, true},
+		"users":              {nil, map[string]UserOptions{"alice": {Command: command}}, true, true},
+		"users without auth": {nil, map[string]UserOptions{"alice": {Command: command}}, false, false},
+		"no command":         {map[string]CommandOptions{"top": {}}, nil, true, false},
+		"no user command":    {nil, map[string]UserOptions{"alice": {}}, true, false},
+		"reserved path":      {map[string]CommandOptions{"js": {Command: command}}, nil, true, false},
+		"oidc path":          {map[string]CommandOptions{"top": {Path: "oidc", Command: command}}, nil, true, false},
+		"root path":          {map[string]CommandOptions{"top": {Path: "/", Command: command}}, nil, true, false},
+		"same path":          {map[string]CommandOptions{"top": {Command: command}, "htop": {Path: "/top", Command: command}}, nil, true, false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			options := DefaultOptions
+			options.Commands = c.commands
+			options.Users = c.users
+			options.EnableBasicAuth = c.auth
+			err := checkRoutes(&options)
+			if c.valid && err != nil {
+				t.Fatalf("expected the routes to be valid: %s", err)
+			}
+			if !c.valid && err == nil {
+				t.Fatal("expected the routes to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// session is a running command attached to a backend, a PTY by default.
+// Output from the backend is fanned out to every attached client.
+type session struct {
+	// Clients send the ID to reattach after reconnecting
+	id  string
+	app *App
+	// The user and the route of the client which started the session
+	user  string
+	route *route
+	// Logs with the ID of the session
+	logger *slog.Logger
+
+	// The command and its arguments
+	argv    []string
+	backend Backend
+
+	startTime time.Time
+	// Bytes written to and read from the backend
+	bytesIn  *int64
+	bytesOut *int64
+
+	// nil unless the RecordDir option is set
+	recorder *recorder
+
+	clientsMutex *sync.Mutex
+	clients      map[*clientContext]bool
+	// Follows the output to know what is on the screen, guarded by clientsMutex.
+	// nil unless clients can join the running session or request its screen.
+	terminal *terminal
+	// Output sent before the first client attaches, kept for it when there is no terminal,
+	// guarded by clientsMutex
+	pending  []byte
+	attached bool
+	// Closes the session when no client reattaches within the SessionGracePeriod option
+	graceTimer *time.Timer
+
+	// Set when the session is closed
+	exit ExitStatus
+
+	closeOnce *sync.Once
+	done      chan bool
+}
+
+func (app *App) startSession(route *route, user string, argv []string) (*session, error) {
+	factory, err := backendFactory(route.backend, app.options)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := factory.Start(argv)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := app.options.Width, app.options.Height
+	if width == 0 {
+		width = 80
+	}
+	if height == 0 {
+		height = 24
+	}
+
+	app.metrics.sessionStarted()
+
+	id := generateRandomString(20)
+	session := &session{
+		id:      id,
+		app:     app,
+		user:    user,
+		route:   route,
+		logger:  app.logger.With("session", id),
+		argv:    argv,
+		backend: backend,
+
+		startTime: time.Now(),
+		bytesIn:   new(int64),
+		bytesOut:  new(int64),
+
+		clientsMutex: &sync.Mutex{},
+		clients:      make(map[*clientContext]bool),
+
+		closeOnce: &sync.Once{},
+		done:      make(chan bool),
+	}
+
+	if app.options.Shared || app.options.SessionGracePeriod > 0 || app.options.EnableSnapshot {
+		session.terminal = newTerminal(width, height, app.options.ScrollbackLines)
+	}
+
+	session.logger.Info("Command is running", "pid", backend.Pid(), "argv", argv, "user", user, "backend", route.backend)
+
+	if app.callbacks.OnSessionStart != nil {
+		app.callbacks.OnSessionStart(session.info())
+	}
+
+	if app.options.RecordDir != "" {
+		header := asciicastHeader{
+			Width:   width,
+			Height:  height,
+			Command: strings.Join(argv, " "),
+		}
+		// Named after the PID, or the session ID for backends without processes
+		suffix := id
+		if pid := backend.Pid(); pid != 0 {
+			suffix = strconv.Itoa(pid)
+		}
+		session.recorder, err = newRecorder(app.options.RecordDir, header, suffix)
+		if err != nil {
+			session.logger.Error("Failed to start recording", "error", err)
+			session.close("recording failed")
+			return nil, err
+		}
+		session.logger.Info("Recording session", "file", session.recorder.name())
+	}
+
+	go session.processOutput()
+
+	return session, nil
+}
+
+// errArgumentsMismatch is returned in shared mode when a client asks for arguments
+// other than those of the running process of the command.
+var errArgumentsMismatch = errors.New("The shared process is running with other arguments")
+
+// acquireSession returns the session a new client should attach to.
+// In shared mode, the running session of the command is reused until it exits,
+// and clients asking for other arguments are rejected.
+// The backend is started outside the lock, while other clients of the shared session wait for it.
+func (app *App) acquireSession(route *route, user string, command []string, argv []string) (*session, error) {
+	key := strings.Join(command, "\x00")
+
+	app.sessionMutex.Lock()
+	for {
+		for id, session := range app.sessions {
+			if session.closed() {
+				delete(app.sessions, id)
+			}
+		}
+
+		if app.sessionsClosed {
+			app.sessionMutex.Unlock()
+			return nil, errors.New("Server is exiting")
+		}
+
+		if !app.options.Shared {
+			break
+		}
+		if session, ok := app.sharedSessions[key]; ok && !session.closed() {
+			app.sessionMutex.Unlock()
+			if !reflect.DeepEqual(session.argv, argv) {
+				return nil, errArgumentsMismatch
+			}
+			return session, nil
+		}
+		started, ok := app.sharedStarts[key]
+		if !ok {
+			break
+		}
+		app.sessionMutex.Unlock()
+		<-started
+		app.sessionMutex.Lock()
+	}
+
+	var started chan bool
+	if app.options.Shared {
+		started = make(chan bool)
+		app.sharedStarts[key] = started
+	}
+	app.sessionMutex.Unlock()
+
+	session, err := app.startSession(route, user, argv)
+
+	app.sessionMutex.Lock()
+	if started != nil {
+		delete(app.sharedStarts, key)
+		close(started)
+	}
+	closing := app.sessionsClosed
+	if err == nil && !closing {
+		app.sessions[session.id] = session
+		if app.options.Shared {
+			app.sharedSessions[key] = session
+		}
+	}
+	app.sessionMutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if closing {
+		session.close("server exiting")
+		return nil, errors.New("Server is exiting")
+	}
+	return session, nil
+}
+
+// reattachSession returns the running session with the ID
+// when it has been started by the same user on the same route.
+func (app *App) reattachSession(id string, route *route, user string) (*session, bool) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	session, ok := app.sessions[id]
+	if !ok || session.closed() || session.route != route || session.user != user {
+		return nil, false
+	}
+	return session, true
+}
+
+func (session *session) pid() int {
+	return session.backend.Pid()
+}
+
+// attach registers a client to receive output.
+// The client first receives a snapshot of the screen and the scrollback
+// unless nothing has been output yet.
+// It returns false when the command has already exited.
+func (session *session) attach(context *clientContext) bool {
+	session.clientsMutex.Lock()
+	defer session.clientsMutex.Unlock()
+
+	if session.closed() {
+		return false
+	}
+	if session.graceTimer != nil {
+		session.graceTimer.Stop()
+		session.graceTimer = nil
+	}
+	context.startQueue()
+	// Queued while holding the lock so that no output is queued before it
+	if session.terminal != nil && !session.terminal.blank() {
+		context.queueMessage(context.outputMessage(session.terminal.snapshot()))
+	} else if len(session.pending) > 0 {
+		context.queueMessage(context.outputMessage(session.pending))
+	}
+	session.pending = nil
+	session.attached = true
+	session.clients[context] = true
+	return true
+}
+
+// detach unregisters a client and returns the number of remaining clients.
+func (session *session) detach(context *clientContext) int {
+	session.clientsMutex.Lock()
+	defer session.clientsMutex.Unlock()
+
+	delete(session.clients, context)
+	close(context.detached)
+	return len(session.clients)
+}
+
+// closeWhenIdle closes the session when no client is attached after the grace period.
+func (session *session) closeWhenIdle(grace time.Duration) {
+	session.clientsMutex.Lock()
+	defer session.clientsMutex.Unlock()
+
+	if len(session.clients) > 0 || session.graceTimer != nil {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(grace, func() {
+		session.clientsMutex.Lock()
+		idle := len(session.clients) == 0 && session.graceTimer == timer
+		session.clientsMutex.Unlock()
+
+		if idle {
+			session.close("no client reattached")
+		}
+	})
+	session.graceTimer = timer
+}
+
+func (session *session) attachedClients() []*clientContext {
+	session.clientsMutex.Lock()
+	defer session.clientsMutex.Unlock()
+
+	return session.clientList()
+}
+
+func (session *session) clientList() []*clientContext {
+	clients := make([]*clientContext, 0, len(session.clients))
+	for context := range session.clients {
+		clients = append(clients, context)
+	}
+	return clients
+}
+
+// maxPendingOutput is the most output kept for the first client, the last part is kept.
+const maxPendingOutput = 64 * 1024
+
+// recordOutput updates the screen with the output and
+// returns the clients to send it to.
+func (session *session) recordOutput(output []byte) []*clientContext {
+	session.clientsMutex.Lock()
+	defer session.clientsMutex.Unlock()
+
+	if session.terminal != nil {
+		session.terminal.write(output)
+	} else if !session.attached {
+		session.pending = append(session.pending, output...)
+		if len(session.pending) > maxPendingOutput {
+			session.pending = session.pending[len(session.pending)-maxPendingOutput:]
+		}
+	}
+	return session.clientList()
+}
+
+func (session *session) processOutput() {
+	chunks := make(chan []byte)
+	go session.readOutput(chunks)
+
+	latency := time.Duration(session.app.options.OutputLatency) * time.Millisecond
+	bufferSize := session.app.options.OutputBufferSize
+
+	exited := false
+	for !exited {
+		output, ok := <-chunks
+		if !ok {
+			break
+		}
+
+		// Coalesce output arriving within the latency window into a single message
+		if latency > 0 {
+			timer := time.NewTimer(latency)
+		collect:
+			for len(output) < bufferSize {
+				select {
+				case chunk, ok := <-chunks:
+					if !ok {
+						exited = true
+						break collect
+					}
+					output = append(output, chunk...)
+				case <-timer.C:
+					break collect
+				}
+			}
+			timer.Stop()
+		}
+
+		for _, context := range session.recordOutput(output) {
+			context.queueMessage(context.outputMessage(output))
+		}
+	}
+
+	session.close("command exited")
+}
+
+func (session *session) readOutput(chunks chan<- []byte) {
+	defer close(chunks)
+
+	buf := make([]byte, session.app.options.OutputBufferSize)
+
+	for {
+		size, err := session.backend.Read(buf)
+		if err != nil {
+			return
+		}
+		atomic.AddInt64(session.bytesOut, int64(size))
+		session.app.metrics.transferred(0, size)
+
+		if session.recorder != nil {
+			if err := session.recorder.writeOutput(buf[:size]); err != nil {
+				session.logger.Warn("Failed to record output", "error", err)
+			}
+		}
+
+		chunk := make([]byte, size)
+		copy(chunk, buf[:size])
+		chunks <- chunk
+	}
+}
+
+// write sends input from a client to the command.
+func (session *session) write(input []byte) error {
+	size, err := session.backend.Write(input)
+	atomic.AddInt64(session.bytesIn, int64(size))
+	session.app.metrics.transferred(size, 0)
+	return err
+}
+
+// showMessage shows a message over the terminal of the attached clients.
+func (session *session) showMessage(message string) {
+	for _, context := range session.attachedClients() {
+		context.queueMessage(append([]byte{ShowMessage}, message...))
+	}
+}
+
+func (session *session) resize(columns uint16, rows uint16) {
+	if err := session.backend.Resize(int(columns), int(rows)); err != nil {
+		session.logger.Warn("Failed to resize terminal", "error", err)
+	}
+
+	session.clientsMutex.Lock()
+	if session.terminal != nil {
+		session.terminal.resize(int(columns), int(rows))
+	}
+	session.clientsMutex.Unlock()
+
+	if session.recorder != nil {
+		if err := session.recorder.writeResize(int(columns), int(rows)); err != nil {
+			session.logger.Warn("Failed to record resize", "error", err)
+		}
+	}
+}
+
+// close terminates the command and disconnects all attached clients.
+// The reason is logged with the exit code of the command.
+func (session *session) close(reason string) {
+	session.closeOnce.Do(func() {
+		session.backend.Close()
+		session.exit = session.backend.Wait()
+		session.app.metrics.sessionClosed(time.Since(session.startTime), session.exit.Code)
+		session.logger.Info("Session closed",
+			"pid", session.pid(), "reason", reason, "exit_code", session.exit.Code, "signal", session.exit.Signal,
+			"duration", time.Since(session.startTime).Round(time.Millisecond).String())
+
+		if session.recorder != nil {
+			session.recorder.close()
+		}
+		if session.app.callbacks.OnSessionEnd != nil {
+			session.app.callbacks.OnSessionEnd(session.info(), session.exit.Code)
+		}
+
+		session.clientsMutex.Lock()
+		close(session.done)
+		session.clientsMutex.Unlock()
+
+		exit, _ := json.Marshal(session.exit)
+		for _, context := range session.attachedClients() {
+			context.queueMessage(append([]byte{SetExitStatus}, exit...))
+			// Disconnects the client once the output before is written
+			context.queueMessage(nil)
+		}
+	})
+}
+
+// screen returns the current screen of the session as text or HTML.
+func (session *session) screen(format string) string {
+	session.clientsMutex.Lock()
+	defer session.clientsMutex.Unlock()
+
+	if format == "html" {
+		return session.terminal.html()
+	}
+	return session.terminal.text()
+}
+
+func (session *session) closed() bool {
+	select {
+	case <-session.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,393 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// resizeBackend records the sizes the backend is resized to.
+type resizeBackend struct {
+	Backend
+	resizes chan [2]int
+}
+
+func (backend *resizeBackend) Resize(columns int, rows int) error {
+	backend.resizes <- [2]int{columns, rows}
+	return nil
+}
+
+// newTestServer serves a command run by the function on a backend registered for the test.
+func newTestServer(t *testing.T, options Options, callbacks *Callbacks, factory BackendFactoryFunc) (*httptest.Server, context.CancelFunc) {
+	name := "test-" + t.Name()
+	RegisterBackend(name, factory)
+	options.Backend = name
+	options.LogLevel = "error"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler, err := NewHandler(ctx, []string{"test"}, &options, callbacks)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+	return server, cancel
+}
+
+func funcFactory(fn func(ctx context.Context, terminal io.ReadWriter) int) BackendFactoryFunc {
+	return func(argv []string) (Backend, error) {
+		return NewFuncBackend(fn), nil
+	}
+}
+
+func dialTestServer(t *testing.T, server *httptest.Server) *websocket.Conn {
+	dialer := websocket.Dialer{Subprotocols: []string{binaryProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	init, _ := json.Marshal(InitMessage{})
+	if err := conn.WriteMessage(websocket.TextMessage, init); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// readMessage returns the first message of the type from the server
+// whose payload contains the string.
+func readMessage(t *testing.T, conn *websocket.Conn, messageType byte, contains string) []byte {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected a message %c containing %q: %s", messageType, contains, err)
+		}
+		if len(data) > 0 && data[0] == messageType && strings.Contains(string(data[1:]), contains) {
+			return data[1:]
+		}
+	}
+}
+
+func TestSessionOutputBeforeAttach(t *testing.T) {
+	name := "test-" + t.Name()
+	RegisterBackend(name, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "early")
+		<-ctx.Done()
+		return 0
+	}))
+	options := DefaultOptions
+	options.Backend = name
+	options.LogLevel = "error"
+	app, err := New([]string{"test"}, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := app.startSession(app.routes[0], "", []string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.close("test")
+
+	// Without a terminal emulator, the output is kept for the client until it attaches
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		session.clientsMutex.Lock()
+		pending := len(session.pending)
+		session.clientsMutex.Unlock()
+		if pending > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the output to be kept")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	connection := newRecordingConnection()
+	context := &clientContext{
+		logger:     app.logger,
+		connection: connection,
+		writeMutex: &sync.Mutex{},
+		binary:     true,
+	}
+	if !session.attach(context) {
+		t.Fatal("expected the client to attach")
+	}
+	session.close("test")
+	select {
+	case <-connection.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+	if len(connection.messages) == 0 || connection.messages[0] != "0early" {
+		t.Fatalf("expected the output before attaching first, got %q", connection.messages)
+	}
+}
+
+func TestSessionExitBeforeAttach(t *testing.T) {
+	name := "test-" + t.Name()
+	RegisterBackend(name, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		return 3
+	}))
+	options := DefaultOptions
+	options.Backend = name
+	options.LogLevel = "error"
+	app, err := New([]string{"test"}, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := app.startSession(app.routes[0], "", []string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-session.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the command to exit")
+	}
+
+	connection := newRecordingConnection()
+	context := &clientContext{
+		app:        app,
+		logger:     app.logger,
+		route:      app.routes[0],
+		connection: connection,
+		session:    session,
+		writeMutex: &sync.Mutex{},
+		binary:     true,
+	}
+	context.goHandleClient()
+	select {
+	case <-connection.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+	last := connection.messages[len(connection.messages)-1]
+	var exit ExitStatus
+	if last[0] != SetExitStatus || json.Unmarshal([]byte(last[1:]), &exit) != nil || exit.Code != 3 {
+		t.Fatalf("expected the exit status to be sent, got %q", connection.messages)
+	}
+}
+
+func TestSessionStartAndExit(t *testing.T) {
+	started := make(chan SessionInfo, 1)
+	ended := make(chan int, 1)
+	options := DefaultOptions
+	options.PermitWrite = true
+	server, _ := newTestServer(t, options, &Callbacks{
+		OnSessionStart: func(session SessionInfo) { started <- session },
+		OnSessionEnd:   func(session SessionInfo, exitCode int) { ended <- exitCode },
+	}, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "name? ")
+		line, _ := bufio.NewReader(terminal).ReadString('\r')
+		io.WriteString(terminal, "hello "+strings.TrimSpace(line))
+		return 3
+	}))
+
+	conn := dialTestServer(t, server)
+	readMessage(t, conn, Output, "name?")
+	if session := <-started; session.Argv[0] != "test" {
+		t.Fatalf("unexpected session started %v", session)
+	}
+
+	conn.WriteMessage(websocket.BinaryMessage, []byte("0alice\r"))
+	readMessage(t, conn, Output, "hello alice")
+
+	var exit ExitStatus
+	if err := json.Unmarshal(readMessage(t, conn, SetExitStatus, ""), &exit); err != nil || exit.Code != 3 {
+		t.Fatalf("expected the exit code 3, got %v %v", exit, err)
+	}
+	if code := <-ended; code != 3 {
+		t.Fatalf("expected the session to end with 3, got %d", code)
+	}
+}
+
+func TestSessionResize(t *testing.T) {
+	resizes := make(chan [2]int, 4)
+	options := DefaultOptions
+	options.PermitWrite = true
+	server, _ := newTestServer(t, options, nil, func(argv []string) (Backend, error) {
+		backend := NewFuncBackend(func(ctx context.Context, terminal io.ReadWriter) int {
+			<-ctx.Done()
+			return 0
+		})
+		return &resizeBackend{Backend: backend, resizes: resizes}, nil
+	})
+
+	conn := dialTestServer(t, server)
+	readMessage(t, conn, SetPreferences, "")
+	conn.WriteMessage(websocket.BinaryMessage, []byte(`2{"Columns":120,"Rows":40}`))
+	conn.WriteMessage(websocket.BinaryMessage, []byte(`2{"Columns":65535,"Rows":65535}`))
+
+	for _, expected := range [][2]int{{120, 40}, {maxTerminalSize, maxTerminalSize}} {
+		select {
+		case size := <-resizes:
+			if size != expected {
+				t.Fatalf("expected the size %v, got %v", expected, size)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected a resize to %v", expected)
+		}
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	ended := make(chan int, 1)
+	options := DefaultOptions
+	server, cancel := newTestServer(t, options, &Callbacks{
+		OnSessionEnd: func(session SessionInfo, exitCode int) { ended <- exitCode },
+	}, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "running")
+		<-ctx.Done()
+		return 130
+	}))
+
+	conn := dialTestServer(t, server)
+	readMessage(t, conn, Output, "running")
+
+	cancel()
+	var exit ExitStatus
+	if err := json.Unmarshal(readMessage(t, conn, SetExitStatus, ""), &exit); err != nil || exit.Code != 130 {
+		t.Fatalf("expected the exit code 130, got %v %v", exit, err)
+	}
+	if code := <-ended; code != 130 {
+		t.Fatalf("expected the session to end with 130, got %d", code)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{binaryProtocol}}
+	if _, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil); err == nil {
+		t.Fatal("expected clients to be rejected after the sessions are closed")
+	}
+}
+
+func TestSessionTerminal(t *testing.T) {
+	name := "test-" + t.Name()
+	RegisterBackend(name, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		<-ctx.Done()
+		return 0
+	}))
+
+	cases := []struct {
+		name     string
+		options  func(options *Options)
+		terminal bool
+	}{
+		{"default", func(options *Options) {}, false},
+		{"shared", func(options *Options) { options.Shared = true }, true},
+		{"grace period", func(options *Options) { options.SessionGracePeriod = 10 }, true},
+		{"snapshot", func(options *Options) { options.EnableSnapshot = true }, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			options := DefaultOptions
+			options.Backend = name
+			options.LogLevel = "error"
+			c.options(&options)
+			app, err := New([]string{"test"}, &options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session, err := app.startSession(app.routes[0], "", []string{"test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.close("test")
+			if (session.terminal != nil) != c.terminal {
+				t.Fatalf("expected the terminal emulator to be created: %t", c.terminal)
+			}
+
+			// Sessions without terminal emulators still take output and resizes
+			session.recordOutput([]byte("hello"))
+			session.resize(100, 30)
+		})
+	}
+}
+
+func TestSessionBlankSnapshot(t *testing.T) {
+	options := DefaultOptions
+	options.Shared = true
+	server, _ := newTestServer(t, options, nil, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		<-ctx.Done()
+		return 0
+	}))
+
+	dialTestServer(t, server)
+	conn := dialTestServer(t, server)
+	readMessage(t, conn, SetPreferences, "")
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if len(data) > 0 && data[0] == Output {
+			t.Fatalf("expected no snapshot of the blank screen, got %q", data[1:])
+		}
+	}
+}
+
+func TestSessionSlowClient(t *testing.T) {
+	options := DefaultOptions
+	options.Shared = true
+	options.PermitWrite = true
+	server, _ := newTestServer(t, options, nil, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		bufio.NewReader(terminal).ReadString('\r')
+		chunk := strings.Repeat("x", 16384)
+		for i := 0; i < 64; i++ {
+			io.WriteString(terminal, chunk)
+		}
+		io.WriteString(terminal, "done")
+		<-ctx.Done()
+		return 0
+	}))
+
+	// Doesn't read the output
+	slow := dialTestServer(t, server)
+	readMessage(t, slow, SetPreferences, "")
+
+	conn := dialTestServer(t, server)
+	readMessage(t, conn, SetPreferences, "")
+	conn.WriteMessage(websocket.BinaryMessage, []byte("0\r"))
+	readMessage(t, conn, Output, "done")
+}
+
+func TestSharedSessionStartedOnce(t *testing.T) {
+	starts := int64(0)
+	options := DefaultOptions
+	options.Shared = true
+	server, _ := newTestServer(t, options, nil, func(argv []string) (Backend, error) {
+		atomic.AddInt64(&starts, 1)
+		// Slow to start, for the clients to connect meanwhile
+		time.Sleep(100 * time.Millisecond)
+		return NewFuncBackend(func(ctx context.Context, terminal io.ReadWriter) int {
+			io.WriteString(terminal, "shared")
+			<-ctx.Done()
+			return 0
+		}), nil
+	})
+
+	conns := []*websocket.Conn{}
+	for i := 0; i < 3; i++ {
+		conns = append(conns, dialTestServer(t, server))
+	}
+	for _, conn := range conns {
+		readMessage(t, conn, Output, "shared")
+	}
+	if starts := atomic.LoadInt64(&starts); starts != 1 {
+		t.Fatalf("expected the shared process to be started once, got %d", starts)
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+)
+
+// snapshotHandler serves the current screen of a session on the route
+// as plain text, or as HTML with format=html.
+// The session is given by its ID with session=<id>, or is the shared session
+// of the command in shared mode.
+func (app *App) snapshotHandler(route *route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := ""
+		if app.connectionTokens != nil {
+			var ok bool
+			user, ok = app.authenticateRequest(r)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		session, ok := app.snapshotSession(route, user, r.URL.Query().Get("session"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "", "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		case "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		default:
+			http.Error(w, "Unknown format "+format, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(session.screen(format)))
+	})
+}
+
+// snapshotSession returns the running session on the route the user can see.
+// Sessions which are not shared are only visible to the user who started them.
+func (app *App) snapshotSession(route *route, user string, id string) (*session, bool) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	var session *session
+	if id != "" {
+		session = app.sessions[id]
+	} else if app.options.Shared {
+		session = app.sharedSessions[strings.Join(app.commandFor(route, user), "\x00")]
+	}
+	if session == nil || session.closed() || session.route != route {
+		return nil, false
+	}
+	if !app.options.Shared && session.user != user {
+		return nil, false
+	}
+	return session, true
+}
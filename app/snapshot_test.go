@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotHandler(t *testing.T) {
+	options := DefaultOptions
+	options.Shared = true
+	options.EnableSnapshot = true
+	server, _ := newTestServer(t, options, nil, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "\x1b[1mhello\x1b[0m <world>")
+		<-ctx.Done()
+		return 0
+	}))
+
+	conn := dialTestServer(t, server)
+	readMessage(t, conn, Output, "world")
+
+	cases := []struct {
+		query       string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"", http.StatusOK, "text/plain; charset=utf-8", "hello <world>"},
+		{"?format=html", http.StatusOK, "text/html; charset=utf-8", "hello</span><span> &lt;world&gt;"},
+		{"?format=pdf", http.StatusBadRequest, "", ""},
+		{"?session=unknown", http.StatusNotFound, "", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			response, err := http.Get(server.URL + "/snapshot" + c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, _ := ioutil.ReadAll(response.Body)
+			if response.StatusCode != c.status {
+				t.Fatalf("expected the status %d, got %d", c.status, response.StatusCode)
+			}
+			if c.contentType != "" && response.Header.Get("Content-Type") != c.contentType {
+				t.Errorf("expected the content type %q, got %q", c.contentType, response.Header.Get("Content-Type"))
+			}
+			if !strings.Contains(string(body), c.body) {
+				t.Errorf("expected the body to contain %q, got %q", c.body, body)
+			}
+		})
+	}
+}
+
+func TestSnapshotHandlerDisabled(t *testing.T) {
+	options := DefaultOptions
+	options.Shared = true
+	server, _ := newTestServer(t, options, nil, funcFactory(func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "hello")
+		<-ctx.Done()
+		return 0
+	}))
+
+	conn := dialTestServer(t, server)
+	readMessage(t, conn, Output, "hello")
+
+	response, err := http.Get(server.URL + "/snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	// Falls through to the static files
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode == http.StatusOK || strings.Contains(string(body), "hello") {
+		t.Fatalf("expected the snapshot to be disabled, got %d %q", response.StatusCode, body)
+	}
+}
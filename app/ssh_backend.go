@@ -0,0 +1,294 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Signals which can be sent to and reported by SSH servers, see RFC 4254 section 6.10
+var sshSignals = map[syscall.Signal]ssh.Signal{
+	syscall.SIGABRT: ssh.SIGABRT,
+	syscall.SIGALRM: ssh.SIGALRM,
+	syscall.SIGFPE:  ssh.SIGFPE,
+	syscall.SIGHUP:  ssh.SIGHUP,
+	syscall.SIGILL:  ssh.SIGILL,
+	syscall.SIGINT:  ssh.SIGINT,
+	syscall.SIGKILL: ssh.SIGKILL,
+	syscall.SIGPIPE: ssh.SIGPIPE,
+	syscall.SIGQUIT: ssh.SIGQUIT,
+	syscall.SIGSEGV: ssh.SIGSEGV,
+	syscall.SIGTERM: ssh.SIGTERM,
+	syscall.SIGUSR1: ssh.SIGUSR1,
+	syscall.SIGUSR2: ssh.SIGUSR2,
+}
+
+// Timeout to connect, authenticate and open the session on SSH servers
+const sshTimeout = 10 * time.Second
+
+// sshBackendFactory opens an SSH session to the host given as the command,
+// "[user@]host[:port] [command...]", and runs the command or the login shell on a PTY.
+type sshBackendFactory struct {
+	identityFile    string
+	password        string
+	useAgent        bool
+	hostKeyCallback ssh.HostKeyCallback
+	closeSignal     syscall.Signal
+}
+
+type sshBackend struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+
+	closeSignal syscall.Signal
+	// Set when the output has ended, i.e. the command has exited
+	eof    *int32
+	exited chan bool
+	// Returned by the session, set before exited is closed
+	err error
+}
+
+func newSSHBackendFactory(options *Options) (*sshBackendFactory, error) {
+	if options.SSHIdentityFile == "" && options.SSHPassword == "" && !options.SSHUseAgent {
+		return nil, errors.New("The ssh backend requires an identity file, a password or the agent")
+	}
+	if options.SSHIdentityFile != "" {
+		if _, err := loadSSHIdentity(options.SSHIdentityFile); err != nil {
+			return nil, err
+		}
+	}
+	if options.SSHUseAgent && os.Getenv("SSH_AUTH_SOCK") == "" {
+		return nil, errors.New("SSH agent is enabled, but SSH_AUTH_SOCK is not set")
+	}
+
+	hostKeyCallback, err := knownhosts.New(ExpandHomeDir(options.SSHKnownHostsFile))
+	if err != nil {
+		return nil, errors.New("Failed to load known hosts: " + err.Error())
+	}
+
+	return &sshBackendFactory{
+		identityFile:    options.SSHIdentityFile,
+		password:        options.SSHPassword,
+		useAgent:        options.SSHUseAgent,
+		hostKeyCallback: hostKeyCallback,
+		closeSignal:     syscall.Signal(options.CloseSignal),
+	}, nil
+}
+
+func loadSSHIdentity(file string) (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(ExpandHomeDir(file))
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil, errors.New("The SSH identity file " + file + " is protected by a passphrase, use the agent instead")
+	}
+	return signer, err
+}
+
+// parseSSHDestination splits "[user@]host[:port]" into the user and the address.
+func parseSSHDestination(destination string) (string, string, error) {
+	username := ""
+	if i := strings.LastIndex(destination, "@"); i >= 0 {
+		username, destination = destination[:i], destination[i+1:]
+	}
+	if username == "" {
+		current, err := user.Current()
+		if err != nil {
+			return "", "", err
+		}
+		username = current.Username
+	}
+
+	if destination == "" {
+		return "", "", errors.New("No host given to the ssh backend")
+	}
+	if _, _, err := net.SplitHostPort(destination); err != nil {
+		destination = net.JoinHostPort(strings.Trim(destination, "[]"), "22")
+	}
+	return username, destination, nil
+}
+
+func (factory *sshBackendFactory) Start(argv []string) (Backend, error) {
+	username, address, err := parseSSHDestination(argv[0])
+	if err != nil {
+		return nil, err
+	}
+
+	auth := []ssh.AuthMethod{}
+	if factory.useAgent {
+		conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return nil, err
+		}
+		// Only used while authenticating
+		defer conn.Close()
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if factory.identityFile != "" {
+		signer, err := loadSSHIdentity(factory.identityFile)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if factory.password != "" {
+		auth = append(auth, ssh.Password(factory.password))
+		// Servers often ask for passwords through keyboard-interactive authentication
+		auth = append(auth, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = factory.password
+			}
+			return answers, nil
+		}))
+	}
+
+	conn, err := net.DialTimeout("tcp", address, sshTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// The timeout of the client config only covers connecting, a stalled server would block forever
+	conn.SetDeadline(time.Now().Add(sshTimeout))
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: factory.hostKeyCallback,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(clientConn, channels, requests)
+
+	backend, err := startSSHSession(client, argv[1:])
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	backend.closeSignal = factory.closeSignal
+	return backend, nil
+}
+
+// shellQuote joins the command line for the remote shell, quoting each argument
+// to be passed as is, as SSH servers run commands with the shell of the user.
+func shellQuote(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@+%") == "" {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+func startSSHSession(client *ssh.Client, command []string) (*sshBackend, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	// The size is updated when a client attaches
+	modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 38400, ssh.TTY_OP_OSPEED: 38400}
+	if err := session.RequestPty("xterm-256color", 24, 80, modes); err != nil {
+		return nil, err
+	}
+	if len(command) > 0 {
+		err = session.Start(shellQuote(command))
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backend := &sshBackend{
+		client:  client,
+		session: session,
+		stdin:   stdin,
+		stdout:  stdout,
+		eof:     new(int32),
+		exited:  make(chan bool),
+	}
+	go func() {
+		backend.err = session.Wait()
+		close(backend.exited)
+	}()
+	return backend, nil
+}
+
+func (backend *sshBackend) Read(p []byte) (int, error) {
+	size, err := backend.stdout.Read(p)
+	if err != nil {
+		atomic.StoreInt32(backend.eof, 1)
+	}
+	return size, err
+}
+
+func (backend *sshBackend) Write(p []byte) (int, error) {
+	return backend.stdin.Write(p)
+}
+
+func (backend *sshBackend) Resize(columns int, rows int) error {
+	return backend.session.WindowChange(rows, columns)
+}
+
+func (backend *sshBackend) Close() error {
+	if atomic.LoadInt32(backend.eof) == 1 {
+		// The exit status follows the end of the output, wait for it before disconnecting
+		select {
+		case <-backend.exited:
+		case <-time.After(time.Second):
+		}
+	} else if signal, ok := sshSignals[backend.closeSignal]; ok {
+		backend.session.Signal(signal)
+	}
+	return backend.client.Close()
+}
+
+func (backend *sshBackend) Wait() ExitStatus {
+	<-backend.exited
+
+	switch err := backend.err.(type) {
+	case nil:
+		return ExitStatus{}
+	case *ssh.ExitError:
+		for number, name := range sshSignals {
+			if string(name) == err.Signal() {
+				return ExitStatus{Code: 128 + int(number), Signal: int(number)}
+			}
+		}
+		return ExitStatus{Code: err.ExitStatus()}
+	default:
+		// The server has not reported the exit status
+		return ExitStatus{Code: -1}
+	}
+}
+
+func (backend *sshBackend) Pid() int {
+	return 0
+}
@@ -0,0 +1,268 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer accepts the password "secret" and the client key,
+// and runs commands by reporting them. The command "sleep" runs until it's closed,
+// others exit with the code 3.
+type testSSHServer struct {
+	address  string
+	hostKey  ssh.Signer
+	commands chan string
+	sizes    chan [2]int
+}
+
+func newTestSSHServer(t *testing.T, clientKey ssh.PublicKey) *testSSHServer {
+	hostKey := newTestSSHSigner(t)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "alice" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "alice" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &testSSHServer{
+		address:  listener.Addr().String(),
+		hostKey:  hostKey,
+		commands: make(chan string, 4),
+		sizes:    make(chan [2]int, 4),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func (server *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for request := range requests {
+				switch request.Type {
+				case "pty-req":
+					request.Reply(true, nil)
+				case "window-change":
+					var size struct{ Columns, Rows, Width, Height uint32 }
+					ssh.Unmarshal(request.Payload, &size)
+					server.sizes <- [2]int{int(size.Columns), int(size.Rows)}
+				case "exec":
+					var exec struct{ Command string }
+					ssh.Unmarshal(request.Payload, &exec)
+					request.Reply(true, nil)
+					server.commands <- exec.Command
+					if exec.Command == "sleep" {
+						continue
+					}
+					channel.Write([]byte("ran " + exec.Command))
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{3}))
+					return
+				default:
+					request.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+func newTestSSHSigner(t *testing.T) ssh.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// writeTestFile writes the content to a file in a temporary directory and returns its path.
+func writeTestFile(t *testing.T, name string, content []byte) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func knownHostsLine(address string, key ssh.PublicKey) []byte {
+	return []byte(knownhosts.Line([]string{knownhosts.Normalize(address)}, key) + "\n")
+}
+
+func newTestSSHOptions(t *testing.T, server *testSSHServer) Options {
+	options := DefaultOptions
+	options.SSHPassword = "secret"
+	options.SSHKnownHostsFile = writeTestFile(t, "known_hosts", knownHostsLine(server.address, server.hostKey.PublicKey()))
+	return options
+}
+
+func startTestSSHBackend(t *testing.T, options Options, argv ...string) (Backend, error) {
+	factory, err := newSSHBackendFactory(&options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, err := factory.Start(argv)
+	if err == nil {
+		t.Cleanup(func() { backend.Close() })
+	}
+	return backend, err
+}
+
+func TestSSHBackendHostKeys(t *testing.T) {
+	server := newTestSSHServer(t, newTestSSHSigner(t).PublicKey())
+	other := newTestSSHSigner(t).PublicKey()
+
+	cases := map[string]struct {
+		knownHosts []byte
+		accepted   bool
+	}{
+		"known":    {knownHostsLine(server.address, server.hostKey.PublicKey()), true},
+		"unknown":  {knownHostsLine("192.0.2.1:22", server.hostKey.PublicKey()), false},
+		"mismatch": {knownHostsLine(server.address, other), false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			options := newTestSSHOptions(t, server)
+			options.SSHKnownHostsFile = writeTestFile(t, "known_hosts", c.knownHosts)
+
+			_, err := startTestSSHBackend(t, options, "alice@"+server.address, "true")
+			if c.accepted && err != nil {
+				t.Fatalf("expected the host key to be accepted: %s", err)
+			}
+			if !c.accepted && err == nil {
+				t.Fatal("expected the host key to be rejected")
+			}
+		})
+	}
+}
+
+func TestSSHBackendAuth(t *testing.T) {
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestSSHServer(t, signer.PublicKey())
+	identityFile := writeTestFile(t, "id_ecdsa", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+
+	cases := map[string]struct {
+		identityFile string
+		password     string
+		accepted     bool
+	}{
+		"identity":       {identityFile, "", true},
+		"password":       {"", "secret", true},
+		"wrong password": {"", "wrong", false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			options := newTestSSHOptions(t, server)
+			options.SSHIdentityFile = c.identityFile
+			options.SSHPassword = c.password
+
+			_, err := startTestSSHBackend(t, options, "alice@"+server.address, "true")
+			if c.accepted && err != nil {
+				t.Fatalf("expected to authenticate: %s", err)
+			}
+			if !c.accepted && err == nil {
+				t.Fatal("expected the authentication to fail")
+			}
+		})
+	}
+}
+
+func TestSSHBackendCommand(t *testing.T) {
+	server := newTestSSHServer(t, newTestSSHSigner(t).PublicKey())
+	backend, err := startTestSSHBackend(t, newTestSSHOptions(t, server),
+		"alice@"+server.address, "echo", "a b", "it's;id", "$HOME", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `echo 'a b' 'it'\''s;id' '$HOME' ''`
+	if command := <-server.commands; command != expected {
+		t.Fatalf("expected the command %s, got %s", expected, command)
+	}
+	output, _ := ioutil.ReadAll(backend)
+	if !strings.HasPrefix(string(output), "ran ") {
+		t.Fatalf("unexpected output %q", output)
+	}
+	if exit := backend.Wait(); exit.Code != 3 {
+		t.Fatalf("expected the exit code 3, got %v", exit)
+	}
+}
+
+func TestSSHBackendResize(t *testing.T) {
+	server := newTestSSHServer(t, newTestSSHSigner(t).PublicKey())
+	backend, err := startTestSSHBackend(t, newTestSSHOptions(t, server), "alice@"+server.address, "sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-server.commands
+
+	if err := backend.Resize(120, 40); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case size := <-server.sizes:
+		if size != [2]int{120, 40} {
+			t.Fatalf("expected the size 120x40, got %v", size)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a window change")
+	}
+}
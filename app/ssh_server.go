@@ -0,0 +1,391 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
+)
+
+// The SSH server serves the same commands as the websocket endpoint to SSH clients.
+// `ssh -p <port> <host>` runs the command given on the command line,
+// and `ssh -t -p <port> <host> <name>` runs the command of the name in the Commands option.
+// Users authenticate with their passwords or tokens as the password.
+// With the SessionGracePeriod option, the session ID is printed to the standard error
+// and `ssh -o SetEnv=GOTTY_SESSION_ID=<ID> ...` reattaches to the process.
+
+// sshSessionIDEnv is the environment variable SSH clients set to reattach to a session.
+const sshSessionIDEnv = "GOTTY_SESSION_ID"
+
+func (app *App) sshServerConfig() (*ssh.ServerConfig, error) {
+	config := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-GoTTY_" + Version,
+	}
+	if app.connectionTokens == nil {
+		config.NoClientAuth = true
+	} else {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if !app.authenticateSSH(conn.User(), string(password)) {
+				app.logger.Warn("SSH authentication failed", "remote_addr", conn.RemoteAddr().String(), "user", conn.User())
+				app.metrics.connectionRejected("auth")
+				return nil, errors.New("Unauthorized")
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"user": conn.User()}}, nil
+		}
+	}
+
+	key, err := ioutil.ReadFile(ExpandHomeDir(app.options.SSHServerHostKey))
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	config.AddHostKey(signer)
+	return config, nil
+}
+
+// authenticateSSH verifies the password of the user, which can also be a token issued for the user.
+func (app *App) authenticateSSH(username string, password string) bool {
+	authenticators := app.currentAuthenticators()
+	if user, ok := authenticateCredential(authenticators, username+":"+password); ok && user == username {
+		return true
+	}
+	user, ok := authenticateCredential(authenticators, password)
+	return ok && user == username
+}
+
+// serveSSH accepts SSH connections until the listener is closed.
+func (app *App) serveSSH(listener net.Listener, config *ssh.ServerConfig) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go app.handleSSHConnection(conn, config)
+	}
+}
+
+func (app *App) handleSSHConnection(conn net.Conn, config *ssh.ServerConfig) {
+	logger := app.logger.With("request", generateRandomString(12), "remote_addr", conn.RemoteAddr().String())
+
+	// Don't let unauthenticated connections linger
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		logger.Info("SSH handshake failed", "error", err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer serverConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	user := ""
+	if serverConn.Permissions != nil {
+		user = serverConn.Permissions.Extensions["user"]
+	}
+	logger.Info("New SSH client connected", "ssh_user", serverConn.User())
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "Only session channels are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			logger.Warn("Failed to accept SSH channel", "error", err)
+			continue
+		}
+		go app.handleSSHChannel(logger, conn.RemoteAddr().String(), user, channel, channelRequests)
+	}
+}
+
+type sshPtyRequest struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+type sshWindowChange struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+type sshExecRequest struct {
+	Command string
+}
+
+type sshEnvRequest struct {
+	Name  string
+	Value string
+}
+
+// handleSSHChannel serves a session channel like a websocket connection once
+// the client requests a shell or a command.
+func (app *App) handleSSHChannel(logger *slog.Logger, remoteAddr string, user string, channel ssh.Channel, requests <-chan *ssh.Request) {
+	var connection *sshConnection
+	size := argResizeTerminal{Columns: 80, Rows: 24}
+	sessionID := ""
+
+	for request := range requests {
+		switch request.Type {
+		case "pty-req":
+			var pty sshPtyRequest
+			if err := ssh.Unmarshal(request.Payload, &pty); err != nil {
+				request.Reply(false, nil)
+				continue
+			}
+			size = argResizeTerminal{Columns: float64(pty.Columns), Rows: float64(pty.Rows)}
+			request.Reply(true, nil)
+
+		case "window-change":
+			var window sshWindowChange
+			if err := ssh.Unmarshal(request.Payload, &window); err != nil || connection == nil {
+				continue
+			}
+			connection.resize(argResizeTerminal{Columns: float64(window.Columns), Rows: float64(window.Rows)})
+
+		case "env":
+			var env sshEnvRequest
+			if err := ssh.Unmarshal(request.Payload, &env); err != nil || env.Name != sshSessionIDEnv {
+				request.Reply(false, nil)
+				continue
+			}
+			sessionID = env.Value
+			request.Reply(true, nil)
+
+		case "shell", "exec":
+			if connection != nil {
+				request.Reply(false, nil)
+				continue
+			}
+			name := ""
+			if request.Type == "exec" {
+				var exec sshExecRequest
+				if err := ssh.Unmarshal(request.Payload, &exec); err != nil {
+					request.Reply(false, nil)
+					continue
+				}
+				name = strings.TrimSpace(exec.Command)
+			}
+
+			route, ok := app.routeByName(name)
+			if !ok {
+				logger.Warn("Unknown command requested over SSH", "name", name)
+				request.Reply(false, nil)
+				continue
+			}
+			request.Reply(true, nil)
+
+			connection = newSSHConnection(channel)
+			connection.resize(size)
+			app.handleSSHClient(logger, remoteAddr, user, route, sessionID, connection)
+
+		default:
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+		}
+	}
+
+	if connection != nil {
+		connection.Close()
+	} else {
+		channel.Close()
+	}
+}
+
+// handleSSHClient counts the connection and serves the client like handleWS.
+func (app *App) handleSSHClient(logger *slog.Logger, remoteAddr string, user string, route *route, sessionID string, connection *sshConnection) {
+	app.stopTimer()
+
+	connections := atomic.AddInt64(app.connections, 1)
+	if maxConnection := app.maxConnection(); maxConnection != 0 {
+		if connections >= int64(maxConnection) {
+			logger.Warn("Reached max connection", "max_connection", maxConnection)
+			connection.Close()
+			app.rejectConnection("max_connection")
+			return
+		}
+	}
+
+	if app.closing() {
+		logger.Warn("Server is exiting")
+		connection.Close()
+		app.rejectConnection("exiting")
+		return
+	}
+
+	role := app.roles.of(user, route.permitWrite)
+	logger = logger.With("user", user, "role", role)
+
+	command := app.commandFor(route, user)
+	context := &clientContext{
+		app:        app,
+		remoteAddr: remoteAddr,
+		logger:     logger,
+		user:       user,
+		role:       role,
+		route:      route,
+		connection: connection,
+		writeMutex: &sync.Mutex{},
+		binary:     true,
+	}
+	app.handleClient(context, command, command, sessionID, connections)
+}
+
+// sshConnection translates the messages of clients to and from an SSH channel.
+// Input and window changes from the channel are read as Input and ResizeTerminal messages,
+// and only output, window titles, messages, session IDs and exit statuses are written to the channel.
+type sshConnection struct {
+	channel ssh.Channel
+
+	input chan []byte
+	// Signaled when size is updated
+	resized chan bool
+	mutex   *sync.Mutex
+	size    *argResizeTerminal
+
+	closeOnce *sync.Once
+	closed    chan bool
+	// Set before closed is closed
+	err error
+}
+
+func newSSHConnection(channel ssh.Channel) *sshConnection {
+	connection := &sshConnection{
+		channel:   channel,
+		input:     make(chan []byte),
+		resized:   make(chan bool, 1),
+		mutex:     &sync.Mutex{},
+		closeOnce: &sync.Once{},
+		closed:    make(chan bool),
+	}
+	go connection.readInput()
+	return connection
+}
+
+func (connection *sshConnection) readInput() {
+	buf := make([]byte, 1024)
+	for {
+		size, err := connection.channel.Read(buf)
+		if err == io.EOF {
+			// The client has no more input, like `ssh host < file`,
+			// but stays connected until the channel is closed
+			return
+		}
+		if err != nil {
+			connection.closeWith(err)
+			return
+		}
+		input := make([]byte, size)
+		copy(input, buf[:size])
+		select {
+		case connection.input <- input:
+		case <-connection.closed:
+			return
+		}
+	}
+}
+
+// resize queues a ResizeTerminal message, replacing the one not read yet.
+func (connection *sshConnection) resize(size argResizeTerminal) {
+	connection.mutex.Lock()
+	connection.size = &size
+	connection.mutex.Unlock()
+
+	select {
+	case connection.resized <- true:
+	default:
+	}
+}
+
+func (connection *sshConnection) ReadMessage() (int, []byte, error) {
+	select {
+	case <-connection.resized:
+		connection.mutex.Lock()
+		size := connection.size
+		connection.mutex.Unlock()
+		data, _ := json.Marshal(size)
+		return websocket.BinaryMessage, append([]byte{ResizeTerminal}, data...), nil
+	case input := <-connection.input:
+		return websocket.BinaryMessage, append([]byte{Input}, input...), nil
+	case <-connection.closed:
+		return 0, nil, connection.err
+	}
+}
+
+func (connection *sshConnection) WriteMessage(messageType int, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var err error
+	switch data[0] {
+	case Output:
+		_, err = connection.channel.Write(data[1:])
+	case SetWindowTitle:
+		_, err = connection.channel.Write([]byte("\x1b]0;" + string(data[1:]) + "\x07"))
+	case ShowMessage:
+		_, err = connection.channel.Write([]byte("\r\n" + string(data[1:]) + "\r\n"))
+	case SetSessionID:
+		// Kept out of the output of commands
+		_, err = connection.channel.Stderr().Write([]byte("GoTTY session ID: " + string(data[1:]) + "\r\n"))
+	case SetExitStatus:
+		var exit ExitStatus
+		if err := json.Unmarshal(data[1:], &exit); err != nil {
+			return err
+		}
+		err = connection.sendExitStatus(exit)
+	}
+	return err
+}
+
+// sendExitStatus sends the exit status to the client, see RFC 4254 section 6.10.
+func (connection *sshConnection) sendExitStatus(exit ExitStatus) error {
+	if name, ok := sshSignals[syscall.Signal(exit.Signal)]; ok && exit.Signal > 0 {
+		payload := ssh.Marshal(struct {
+			Signal     string
+			CoreDumped bool
+			Message    string
+			Language   string
+		}{string(name), false, "", ""})
+		_, err := connection.channel.SendRequest("exit-signal", false, payload)
+		return err
+	}
+	if exit.Code < 0 {
+		return nil
+	}
+	_, err := connection.channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(exit.Code)}))
+	return err
+}
+
+func (connection *sshConnection) closeWith(err error) {
+	connection.closeOnce.Do(func() {
+		connection.err = err
+		close(connection.closed)
+		connection.channel.Close()
+	})
+}
+
+func (connection *sshConnection) Close() error {
+	connection.closeWith(io.EOF)
+	return nil
+}
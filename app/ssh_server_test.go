@@ -0,0 +1,249 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestSSHApp serves the function on an SSH server with the options,
+// under the name "test" and as the command "other".
+func newTestSSHApp(t *testing.T, options Options, fn func(ctx context.Context, terminal io.ReadWriter) int) (*App, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "test-" + t.Name()
+	RegisterBackend(name, funcFactory(fn))
+	options.Backend = name
+	options.LogLevel = "error"
+	options.SSHServerHostKey = writeTestFile(t, "ssh_host_key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	options.Commands = map[string]CommandOptions{"other": {Command: []string{"other"}}}
+
+	app, err := New([]string{"test"}, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := app.sshServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		app.closeSessions("test done")
+	})
+	go app.serveSSH(listener, config)
+	return app, listener.Addr().String()
+}
+
+func dialTestSSHServer(address string, user string, password string) (*ssh.Client, error) {
+	return ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+}
+
+func TestSSHServer(t *testing.T) {
+	options := DefaultOptions
+	options.PermitWrite = true
+	_, address := newTestSSHApp(t, options, func(ctx context.Context, terminal io.ReadWriter) int {
+		io.WriteString(terminal, "name? ")
+		line, _ := bufio.NewReader(terminal).ReadString('\r')
+		io.WriteString(terminal, "hello "+strings.TrimSpace(line)+"\n")
+		return 3
+	})
+
+	client, err := dialTestSSHServer(address, "anyone", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	session.Stdin = strings.NewReader("alice\r")
+	output := &strings.Builder{}
+	session.Stdout = output
+
+	err = session.Run("")
+	if exit, ok := err.(*ssh.ExitError); !ok || exit.ExitStatus() != 3 {
+		t.Fatalf("expected the exit status 3, got %v", err)
+	}
+	if !strings.Contains(output.String(), "hello alice") {
+		t.Fatalf("unexpected output %q", output.String())
+	}
+}
+
+func TestSSHServerCommands(t *testing.T) {
+	_, address := newTestSSHApp(t, DefaultOptions, func(ctx context.Context, terminal io.ReadWriter) int {
+		return 0
+	})
+	client, err := dialTestSSHServer(address, "anyone", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for command, ok := range map[string]bool{"other": true, "unknown": false} {
+		session, err := client.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = session.Run(command)
+		if ok && err != nil {
+			t.Errorf("expected %s to run: %s", command, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("expected %s to be rejected", command)
+		}
+	}
+}
+
+func TestSSHServerAuth(t *testing.T) {
+	options := DefaultOptions
+	options.EnableBasicAuth = true
+	options.Credential = "alice:secret"
+	options.TokenFile = writeTestFile(t, "tokens", []byte("bob:0123456789abcdef\n"))
+	app, address := newTestSSHApp(t, options, func(ctx context.Context, terminal io.ReadWriter) int {
+		return 0
+	})
+
+	cases := map[string]struct {
+		user     string
+		password string
+		accepted bool
+	}{
+		"password":       {"alice", "secret", true},
+		"wrong password": {"alice", "wrong", false},
+		"token":          {"bob", "0123456789abcdef", true},
+		"token of other": {"alice", "0123456789abcdef", false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			client, err := dialTestSSHServer(address, c.user, c.password)
+			if c.accepted && err != nil {
+				t.Fatalf("expected to authenticate: %s", err)
+			}
+			if !c.accepted && err == nil {
+				client.Close()
+				t.Fatal("expected the authentication to fail")
+			}
+			if err == nil {
+				client.Close()
+			}
+		})
+	}
+
+	var buffer bytes.Buffer
+	app.metrics.write(&buffer, 0, 0)
+	if !strings.Contains(buffer.String(), `gotty_rejected_connections_total{reason="auth"} 2`) {
+		t.Errorf("expected the failed authentications to be counted, got\n%s", buffer.String())
+	}
+}
+
+func TestSSHServerReattach(t *testing.T) {
+	options := DefaultOptions
+	options.SessionGracePeriod = 60
+	started := int32(0)
+	_, address := newTestSSHApp(t, options, func(ctx context.Context, terminal io.ReadWriter) int {
+		fmt.Fprintf(terminal, "started %d\r\n", atomic.AddInt32(&started, 1))
+		<-ctx.Done()
+		return 0
+	})
+
+	// startShell runs the shell with the environment variables and returns its output and error output
+	startShell := func(env map[string]string) (*ssh.Client, *bufio.Reader, *bufio.Reader) {
+		client, err := dialTestSSHServer(address, "anyone", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, err := client.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range env {
+			if err := session.Setenv(name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+			t.Fatal(err)
+		}
+		stdout, _ := session.StdoutPipe()
+		stderr, _ := session.StderrPipe()
+		if err := session.Shell(); err != nil {
+			t.Fatal(err)
+		}
+		return client, bufio.NewReader(stdout), bufio.NewReader(stderr)
+	}
+	readLine := func(reader *bufio.Reader, prefix string) string {
+		lines := make(chan string, 1)
+		go func() {
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					close(lines)
+					return
+				}
+				if index := strings.Index(line, prefix); index >= 0 {
+					lines <- strings.TrimSpace(line[index+len(prefix):])
+					return
+				}
+			}
+		}()
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("expected a line with %q", prefix)
+			}
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for a line with %q", prefix)
+			return ""
+		}
+	}
+
+	client, stdout, stderr := startShell(nil)
+	id := readLine(stderr, "GoTTY session ID: ")
+	if number := readLine(stdout, "started "); number != "1" {
+		t.Fatalf("expected the first process, got %s", number)
+	}
+	client.Close()
+
+	client, stdout, _ = startShell(map[string]string{sshSessionIDEnv: id})
+	defer client.Close()
+	// The screen of the process is sent on reattaching
+	if number := readLine(stdout, "started "); number != "1" {
+		t.Fatalf("expected to reattach to the first process, got %s", number)
+	}
+	if count := atomic.LoadInt32(&started); count != 1 {
+		t.Fatalf("expected a single process, got %d", count)
+	}
+}
@@ -0,0 +1,1057 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Largest number of columns and rows accepted from clients,
+// as the screens of the size are allocated
+const maxTerminalSize = 1000
+
+// terminal is a VT100/xterm emulator which follows the output of a session
+// to know what is on the screen. It understands the subset of control
+// sequences used by shells and full-screen programs like vim, less and top.
+type terminal struct {
+	width  int
+	height int
+
+	main      [][]terminalCell
+	alternate [][]terminalCell
+	// Points to main or alternate
+	screen         [][]terminalCell
+	alternateShown bool
+
+	// Lines scrolled off the top of the main screen, oldest first
+	history      [][]terminalCell
+	historyLimit int
+
+	cursorX     int
+	cursorY     int
+	wrapPending bool
+	style       terminalStyle
+
+	savedX     int
+	savedY     int
+	savedStyle terminalStyle
+
+	// Scrolling region, inclusive
+	top    int
+	bottom int
+
+	// DEC private modes which differ from the defaults, see terminalModes
+	modes map[int]bool
+
+	parser terminalParser
+}
+
+type terminalCell struct {
+	// Empty for a blank cell and for the right half of a wide character
+	text  string
+	wide  bool
+	style terminalStyle
+}
+
+// Colors are terminalDefaultColor, an index of the 256 color palette,
+// or an RGB value with terminalRGBColor set.
+type terminalStyle struct {
+	fg    int32
+	bg    int32
+	flags uint8
+}
+
+const (
+	terminalDefaultColor = -1
+	terminalRGBColor     = 1 << 24
+)
+
+const (
+	styleBold = 1 << iota
+	styleFaint
+	styleItalic
+	styleUnderline
+	styleBlink
+	styleReverse
+	styleHidden
+	styleStrike
+)
+
+var defaultTerminalStyle = terminalStyle{fg: terminalDefaultColor, bg: terminalDefaultColor}
+
+// DEC private modes followed by the terminal, with their default values
+var terminalModes = map[int]bool{
+	1:    false, // Application cursor keys
+	7:    true,  // Auto wrap
+	25:   true,  // Cursor visible
+	1000: false, // Mouse tracking
+	1002: false,
+	1003: false,
+	1006: false,
+	2004: false, // Bracketed paste
+}
+
+type terminalParserState int
+
+const (
+	stateGround terminalParserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	// OSC, DCS, SOS, PM and APC strings, terminated by BEL or ST
+	stateString
+	stateStringEscape
+)
+
+type terminalParser struct {
+	state  terminalParserState
+	params []byte
+	// Pending bytes of a UTF-8 sequence
+	utf8 []byte
+	// OSC strings are kept to follow the window title
+	osc   bool
+	str   []byte
+	title string
+}
+
+func newTerminal(width int, height int, historyLimit int) *terminal {
+	terminal := &terminal{
+		historyLimit: historyLimit,
+		modes:        make(map[int]bool),
+		style:        defaultTerminalStyle,
+		savedStyle:   defaultTerminalStyle,
+	}
+	terminal.width, terminal.height = width, height
+	terminal.main = newTerminalScreen(width, height)
+	terminal.alternate = newTerminalScreen(width, height)
+	terminal.screen = terminal.main
+	terminal.top, terminal.bottom = 0, height-1
+	return terminal
+}
+
+func newTerminalScreen(width int, height int) [][]terminalCell {
+	screen := make([][]terminalCell, height)
+	for y := range screen {
+		screen[y] = newTerminalLine(width, defaultTerminalStyle)
+	}
+	return screen
+}
+
+func newTerminalLine(width int, style terminalStyle) []terminalCell {
+	line := make([]terminalCell, width)
+	for x := range line {
+		line[x].style = terminalStyle{fg: terminalDefaultColor, bg: style.bg}
+	}
+	return line
+}
+
+func (terminal *terminal) mode(mode int) bool {
+	if value, ok := terminal.modes[mode]; ok {
+		return value
+	}
+	return terminalModes[mode]
+}
+
+func (terminal *terminal) inAlternateScreen() bool {
+	return terminal.alternateShown
+}
+
+// resize changes the size of the screens, keeping the cursor line visible.
+func (terminal *terminal) resize(width int, height int) {
+	if width <= 0 || height <= 0 || (width == terminal.width && height == terminal.height) {
+		return
+	}
+	alternate := terminal.inAlternateScreen()
+
+	// When shrinking, lines below the cursor are dropped first, then lines at the top.
+	// The main screen behind the alternate screen keeps its last non-blank line instead.
+	mainCursorY := terminal.cursorY
+	if alternate {
+		mainCursorY = 0
+		for y, line := range terminal.main {
+			if !blankTerminalLine(line) {
+				mainCursorY = y
+			}
+		}
+	}
+	mainScrolled := 0
+	if mainCursorY >= height {
+		mainScrolled = mainCursorY - height + 1
+	}
+	alternateScrolled := 0
+	if alternate && terminal.cursorY >= height {
+		alternateScrolled = terminal.cursorY - height + 1
+	}
+
+	for _, line := range terminal.main[:mainScrolled] {
+		terminal.pushHistory(line)
+	}
+	terminal.main = resizeTerminalScreen(terminal.main[mainScrolled:], width, height)
+	terminal.alternate = resizeTerminalScreen(terminal.alternate[alternateScrolled:], width, height)
+	for i, line := range terminal.history {
+		if len(line) > width {
+			terminal.history[i] = line[:width]
+		}
+	}
+
+	if alternate {
+		terminal.screen = terminal.alternate
+		terminal.cursorY -= alternateScrolled
+		// The cursor saved when switching to the alternate screen is on the main screen
+		terminal.savedY -= mainScrolled
+	} else {
+		terminal.screen = terminal.main
+		terminal.cursorY -= mainScrolled
+		terminal.savedY -= mainScrolled
+	}
+
+	terminal.width, terminal.height = width, height
+	terminal.top, terminal.bottom = 0, height-1
+	terminal.cursorX = clamp(terminal.cursorX, 0, width-1)
+	terminal.cursorY = clamp(terminal.cursorY, 0, height-1)
+	terminal.savedX = clamp(terminal.savedX, 0, width-1)
+	terminal.savedY = clamp(terminal.savedY, 0, height-1)
+	terminal.wrapPending = false
+}
+
+func resizeTerminalScreen(screen [][]terminalCell, width int, height int) [][]terminalCell {
+	resized := make([][]terminalCell, height)
+	for y := range resized {
+		switch {
+		case y >= len(screen):
+			resized[y] = newTerminalLine(width, defaultTerminalStyle)
+		case len(screen[y]) >= width:
+			resized[y] = screen[y][:width]
+		default:
+			resized[y] = append(screen[y], newTerminalLine(width-len(screen[y]), defaultTerminalStyle)...)
+		}
+	}
+	return resized
+}
+
+func blankTerminalLine(line []terminalCell) bool {
+	for _, cell := range line {
+		if cell.text != "" || cell.style != defaultTerminalStyle {
+			return false
+		}
+	}
+	return true
+}
+
+func (terminal *terminal) pushHistory(line []terminalCell) {
+	if terminal.historyLimit <= 0 {
+		return
+	}
+	terminal.history = append(terminal.history, line)
+	if len(terminal.history) > terminal.historyLimit {
+		// The dropped lines are freed when append reallocates the slice
+		terminal.history = terminal.history[len(terminal.history)-terminal.historyLimit:]
+	}
+}
+
+func (terminal *terminal) write(data []byte) {
+	for _, b := range data {
+		terminal.parse(b)
+	}
+}
+
+func (terminal *terminal) parse(b byte) {
+	parser := &terminal.parser
+
+	switch parser.state {
+	case stateGround:
+		switch {
+		case len(parser.utf8) > 0 && b >= 0x80 && b < 0xc0:
+			parser.utf8 = append(parser.utf8, b)
+			if utf8.FullRune(parser.utf8) {
+				r, _ := utf8.DecodeRune(parser.utf8)
+				parser.utf8 = parser.utf8[:0]
+				terminal.print(r)
+			}
+		case b == 0x1b:
+			parser.utf8 = parser.utf8[:0]
+			parser.state = stateEscape
+		case b < 0x20 || b == 0x7f:
+			parser.utf8 = parser.utf8[:0]
+			terminal.control(b)
+		case b < 0x80:
+			parser.utf8 = parser.utf8[:0]
+			terminal.print(rune(b))
+		default:
+			parser.utf8 = append(parser.utf8[:0], b)
+			if utf8.FullRune(parser.utf8) {
+				// An invalid start byte
+				parser.utf8 = parser.utf8[:0]
+				terminal.print(utf8.RuneError)
+			}
+		}
+
+	case stateEscape:
+		parser.state = stateGround
+		switch b {
+		case '[':
+			parser.state = stateCSI
+			parser.params = parser.params[:0]
+		case ']', 'P', 'X', '^', '_':
+			parser.state = stateString
+			parser.osc = b == ']'
+			parser.str = parser.str[:0]
+		case '(', ')', '*', '+', '#', '%', ' ':
+			parser.state = stateEscapeIntermediate
+		case '7':
+			terminal.saveCursor()
+		case '8':
+			terminal.restoreCursor()
+		case 'D':
+			terminal.lineFeed()
+		case 'E':
+			terminal.cursorX = 0
+			terminal.lineFeed()
+		case 'M':
+			terminal.reverseIndex()
+		case 'c':
+			terminal.reset()
+		case 0x1b:
+			parser.state = stateEscape
+		}
+
+	case stateEscapeIntermediate:
+		// The character set and line size are ignored
+		parser.state = stateGround
+
+	case stateCSI:
+		switch {
+		case b == 0x1b:
+			parser.state = stateEscape
+		case b >= 0x40 && b <= 0x7e:
+			parser.state = stateGround
+			terminal.csi(string(parser.params), b)
+		case b < 0x20:
+			terminal.control(b)
+		default:
+			if len(parser.params) < 256 {
+				parser.params = append(parser.params, b)
+			}
+		}
+
+	case stateString:
+		switch b {
+		case 0x07:
+			terminal.endString()
+		case 0x1b:
+			parser.state = stateStringEscape
+		default:
+			if len(parser.str) < 1024 {
+				parser.str = append(parser.str, b)
+			}
+		}
+
+	case stateStringEscape:
+		if b == '\\' {
+			terminal.endString()
+		} else {
+			parser.state = stateString
+		}
+	}
+}
+
+func (terminal *terminal) endString() {
+	parser := &terminal.parser
+	parser.state = stateGround
+	if !parser.osc {
+		return
+	}
+	parts := strings.SplitN(string(parser.str), ";", 2)
+	if len(parts) == 2 && (parts[0] == "0" || parts[0] == "2") {
+		parser.title = parts[1]
+	}
+}
+
+func (terminal *terminal) control(b byte) {
+	switch b {
+	case '\b':
+		if terminal.cursorX > 0 {
+			terminal.cursorX--
+		}
+		terminal.wrapPending = false
+	case '\t':
+		terminal.cursorX = clamp((terminal.cursorX/8+1)*8, 0, terminal.width-1)
+		terminal.wrapPending = false
+	case '\n', '\v', '\f':
+		terminal.lineFeed()
+	case '\r':
+		terminal.cursorX = 0
+		terminal.wrapPending = false
+	}
+}
+
+func (terminal *terminal) print(r rune) {
+	width := runeWidth(r)
+	if width == 0 {
+		// Combine with the previous character
+		x := terminal.cursorX
+		if !terminal.wrapPending {
+			x--
+		}
+		line := terminal.screen[terminal.cursorY]
+		if isWideTail(line, x) {
+			x--
+		}
+		if x >= 0 && line[x].text != "" {
+			line[x].text += string(r)
+		}
+		return
+	}
+
+	if width > terminal.width {
+		// A wide character doesn't fit on a single column terminal
+		return
+	}
+	if terminal.wrapPending || terminal.cursorX+width > terminal.width {
+		if terminal.mode(7) {
+			terminal.cursorX = 0
+			terminal.lineFeed()
+		} else {
+			terminal.cursorX = terminal.width - width
+		}
+	}
+	terminal.wrapPending = false
+
+	line := terminal.screen[terminal.cursorY]
+	clearWideHead(line, terminal.cursorX)
+	line[terminal.cursorX] = terminalCell{text: string(r), wide: width == 2, style: terminal.style}
+	if width == 2 {
+		line[terminal.cursorX+1] = terminalCell{style: terminal.style}
+	}
+
+	if terminal.cursorX+width >= terminal.width {
+		terminal.cursorX = terminal.width - 1
+		terminal.wrapPending = true
+	} else {
+		terminal.cursorX += width
+	}
+}
+
+// clearWideHead blanks the left half of a wide character when its right half at x is overwritten.
+// An orphaned right half is a blank cell by itself.
+func clearWideHead(line []terminalCell, x int) {
+	if isWideTail(line, x) {
+		line[x-1] = terminalCell{style: line[x-1].style}
+	}
+}
+
+// isWideTail returns true when the cell at x is the right half of a wide character.
+func isWideTail(line []terminalCell, x int) bool {
+	return x > 0 && x < len(line) && line[x].text == "" && line[x-1].wide
+}
+
+func (terminal *terminal) lineFeed() {
+	terminal.wrapPending = false
+	if terminal.cursorY == terminal.bottom {
+		terminal.scrollUp(1)
+	} else if terminal.cursorY < terminal.height-1 {
+		terminal.cursorY++
+	}
+}
+
+func (terminal *terminal) reverseIndex() {
+	terminal.wrapPending = false
+	if terminal.cursorY == terminal.top {
+		terminal.scrollDown(1)
+	} else if terminal.cursorY > 0 {
+		terminal.cursorY--
+	}
+}
+
+// scrollUp scrolls the lines in the scrolling region up.
+func (terminal *terminal) scrollUp(n int) {
+	n = clamp(n, 0, terminal.bottom-terminal.top+1)
+	region := terminal.screen[terminal.top : terminal.bottom+1]
+	if terminal.top == 0 && !terminal.inAlternateScreen() {
+		for _, line := range region[:n] {
+			terminal.pushHistory(line)
+		}
+	}
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = newTerminalLine(terminal.width, terminal.style)
+	}
+}
+
+// scrollDown scrolls the lines in the scrolling region down.
+func (terminal *terminal) scrollDown(n int) {
+	n = clamp(n, 0, terminal.bottom-terminal.top+1)
+	region := terminal.screen[terminal.top : terminal.bottom+1]
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = newTerminalLine(terminal.width, terminal.style)
+	}
+}
+
+func (terminal *terminal) saveCursor() {
+	terminal.savedX, terminal.savedY = terminal.cursorX, terminal.cursorY
+	terminal.savedStyle = terminal.style
+}
+
+func (terminal *terminal) restoreCursor() {
+	terminal.cursorX, terminal.cursorY = terminal.savedX, terminal.savedY
+	terminal.style = terminal.savedStyle
+	terminal.wrapPending = false
+}
+
+func (terminal *terminal) reset() {
+	title := terminal.parser.title
+	*terminal = *newTerminal(terminal.width, terminal.height, terminal.historyLimit)
+	terminal.parser.title = title
+}
+
+func (terminal *terminal) csi(params string, final byte) {
+	private := strings.HasPrefix(params, "?")
+	if private || strings.HasPrefix(params, ">") || strings.HasPrefix(params, "=") {
+		params = params[1:]
+	}
+	args := []int{}
+	for _, param := range strings.Split(params, ";") {
+		// Sub-parameters like "38:2:..." are not supported
+		value, err := strconv.Atoi(param)
+		if err != nil {
+			value = 0
+		}
+		args = append(args, value)
+	}
+	arg := func(i int, defaultValue int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return defaultValue
+	}
+
+	terminal.wrapPending = false
+	line := terminal.screen[terminal.cursorY]
+
+	switch final {
+	case '@':
+		n := clamp(arg(0, 1), 0, terminal.width-terminal.cursorX)
+		copy(line[terminal.cursorX+n:], line[terminal.cursorX:])
+		terminal.erase(line, terminal.cursorX, terminal.cursorX+n)
+	case 'A':
+		terminal.cursorY = clamp(terminal.cursorY-arg(0, 1), 0, terminal.height-1)
+	case 'B', 'e':
+		terminal.cursorY = clamp(terminal.cursorY+arg(0, 1), 0, terminal.height-1)
+	case 'C', 'a':
+		terminal.cursorX = clamp(terminal.cursorX+arg(0, 1), 0, terminal.width-1)
+	case 'D':
+		terminal.cursorX = clamp(terminal.cursorX-arg(0, 1), 0, terminal.width-1)
+	case 'E':
+		terminal.cursorX = 0
+		terminal.cursorY = clamp(terminal.cursorY+arg(0, 1), 0, terminal.height-1)
+	case 'F':
+		terminal.cursorX = 0
+		terminal.cursorY = clamp(terminal.cursorY-arg(0, 1), 0, terminal.height-1)
+	case 'G', '`':
+		terminal.cursorX = clamp(arg(0, 1)-1, 0, terminal.width-1)
+	case 'H', 'f':
+		terminal.cursorY = clamp(arg(0, 1)-1, 0, terminal.height-1)
+		terminal.cursorX = clamp(arg(1, 1)-1, 0, terminal.width-1)
+	case 'd':
+		terminal.cursorY = clamp(arg(0, 1)-1, 0, terminal.height-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			terminal.erase(line, terminal.cursorX, terminal.width)
+			for _, l := range terminal.screen[terminal.cursorY+1:] {
+				terminal.erase(l, 0, terminal.width)
+			}
+		case 1:
+			terminal.erase(line, 0, terminal.cursorX+1)
+			for _, l := range terminal.screen[:terminal.cursorY] {
+				terminal.erase(l, 0, terminal.width)
+			}
+		case 2, 3:
+			for _, l := range terminal.screen {
+				terminal.erase(l, 0, terminal.width)
+			}
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			terminal.erase(line, terminal.cursorX, terminal.width)
+		case 1:
+			terminal.erase(line, 0, terminal.cursorX+1)
+		case 2:
+			terminal.erase(line, 0, terminal.width)
+		}
+	case 'L', 'M':
+		if terminal.cursorY < terminal.top || terminal.cursorY > terminal.bottom {
+			break
+		}
+		top := terminal.top
+		terminal.top = terminal.cursorY
+		if final == 'L' {
+			terminal.scrollDown(arg(0, 1))
+		} else {
+			// Deleted lines don't go into the history
+			region := terminal.screen[terminal.top : terminal.bottom+1]
+			n := clamp(arg(0, 1), 0, len(region))
+			copy(region, region[n:])
+			for i := len(region) - n; i < len(region); i++ {
+				region[i] = newTerminalLine(terminal.width, terminal.style)
+			}
+		}
+		terminal.top = top
+		terminal.cursorX = 0
+	case 'P':
+		n := clamp(arg(0, 1), 0, terminal.width-terminal.cursorX)
+		copy(line[terminal.cursorX:], line[terminal.cursorX+n:])
+		terminal.erase(line, terminal.width-n, terminal.width)
+	case 'X':
+		terminal.erase(line, terminal.cursorX, clamp(terminal.cursorX+arg(0, 1), 0, terminal.width))
+	case 'S':
+		if !private {
+			terminal.scrollUp(arg(0, 1))
+		}
+	case 'T':
+		if len(args) <= 1 {
+			terminal.scrollDown(arg(0, 1))
+		}
+	case 'm':
+		if !private {
+			terminal.sgr(args)
+		}
+	case 'r':
+		if private {
+			break
+		}
+		top := clamp(arg(0, 1)-1, 0, terminal.height-1)
+		bottom := clamp(arg(1, terminal.height)-1, 0, terminal.height-1)
+		if top < bottom {
+			terminal.top, terminal.bottom = top, bottom
+			terminal.cursorX, terminal.cursorY = 0, 0
+		}
+	case 's':
+		terminal.saveCursor()
+	case 'u':
+		terminal.restoreCursor()
+	case 'h', 'l':
+		if private {
+			for _, mode := range args {
+				terminal.setMode(mode, final == 'h')
+			}
+		}
+	}
+}
+
+func (terminal *terminal) setMode(mode int, set bool) {
+	switch mode {
+	case 47, 1047, 1049:
+		if set == terminal.inAlternateScreen() {
+			return
+		}
+		if set {
+			if mode == 1049 {
+				terminal.saveCursor()
+			}
+			terminal.alternate = newTerminalScreen(terminal.width, terminal.height)
+			terminal.screen = terminal.alternate
+		} else {
+			terminal.screen = terminal.main
+			if mode == 1049 {
+				terminal.restoreCursor()
+			}
+		}
+		terminal.alternateShown = set
+		return
+	}
+
+	if defaultValue, ok := terminalModes[mode]; ok {
+		if set == defaultValue {
+			delete(terminal.modes, mode)
+		} else {
+			terminal.modes[mode] = set
+		}
+	}
+}
+
+// erase blanks the cells in [from, to) with the current background color.
+func (terminal *terminal) erase(line []terminalCell, from int, to int) {
+	from = clamp(from, 0, len(line))
+	to = clamp(to, 0, len(line))
+	if from < to {
+		clearWideHead(line, from)
+	}
+	for x := from; x < to; x++ {
+		line[x] = terminalCell{style: terminalStyle{fg: terminalDefaultColor, bg: terminal.style.bg}}
+	}
+}
+
+func (terminal *terminal) sgr(args []int) {
+	for i := 0; i < len(args); i++ {
+		style := &terminal.style
+		switch arg := args[i]; {
+		case arg == 0:
+			*style = defaultTerminalStyle
+		case arg == 1:
+			style.flags |= styleBold
+		case arg == 2:
+			style.flags |= styleFaint
+		case arg == 3:
+			style.flags |= styleItalic
+		case arg == 4:
+			style.flags |= styleUnderline
+		case arg == 5:
+			style.flags |= styleBlink
+		case arg == 7:
+			style.flags |= styleReverse
+		case arg == 8:
+			style.flags |= styleHidden
+		case arg == 9:
+			style.flags |= styleStrike
+		case arg == 22:
+			style.flags &^= styleBold | styleFaint
+		case arg == 23:
+			style.flags &^= styleItalic
+		case arg == 24:
+			style.flags &^= styleUnderline
+		case arg == 25:
+			style.flags &^= styleBlink
+		case arg == 27:
+			style.flags &^= styleReverse
+		case arg == 28:
+			style.flags &^= styleHidden
+		case arg == 29:
+			style.flags &^= styleStrike
+		case arg >= 30 && arg <= 37:
+			style.fg = int32(arg - 30)
+		case arg == 39:
+			style.fg = terminalDefaultColor
+		case arg >= 40 && arg <= 47:
+			style.bg = int32(arg - 40)
+		case arg == 49:
+			style.bg = terminalDefaultColor
+		case arg >= 90 && arg <= 97:
+			style.fg = int32(arg - 90 + 8)
+		case arg >= 100 && arg <= 107:
+			style.bg = int32(arg - 100 + 8)
+		case arg == 38 || arg == 48:
+			color, used := extendedColor(args[i+1:])
+			i += used
+			if color == terminalDefaultColor {
+				break
+			}
+			if arg == 38 {
+				style.fg = color
+			} else {
+				style.bg = color
+			}
+		}
+	}
+}
+
+// extendedColor parses the arguments of 38 and 48 in SGR, like 5;n or 2;r;g;b.
+func extendedColor(args []int) (int32, int) {
+	if len(args) >= 2 && args[0] == 5 {
+		return int32(clamp(args[1], 0, 255)), 2
+	}
+	if len(args) >= 4 && args[0] == 2 {
+		r, g, b := clamp(args[1], 0, 255), clamp(args[2], 0, 255), clamp(args[3], 0, 255)
+		return int32(terminalRGBColor | r<<16 | g<<8 | b), 4
+	}
+	return terminalDefaultColor, len(args)
+}
+
+// text returns the characters on the screen, one line for each row.
+func (terminal *terminal) text() string {
+	lines := make([]string, 0, terminal.height)
+	for _, line := range terminal.screen {
+		var buffer bytes.Buffer
+		for x, cell := range line {
+			switch {
+			case cell.text != "":
+				buffer.WriteString(cell.text)
+			case !isWideTail(line, x):
+				buffer.WriteByte(' ')
+			}
+		}
+		lines = append(lines, strings.TrimRight(buffer.String(), " "))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// html renders the screen in a <pre> element with colors and styles.
+func (terminal *terminal) html() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(`<pre class="gotty-screen" style="color: #f0f0f0; background: #101010;">`)
+	for y, line := range terminal.screen {
+		open := false
+		var current terminalStyle
+		for x := range line {
+			cell := &line[x]
+			if isWideTail(line, x) {
+				continue
+			}
+			if !open || cell.style != current {
+				if open {
+					buffer.WriteString("</span>")
+				}
+				current = cell.style
+				open = true
+				if css := styleCSS(current); css != "" {
+					fmt.Fprintf(&buffer, `<span style="%s">`, css)
+				} else {
+					buffer.WriteString("<span>")
+				}
+			}
+			if cell.text == "" {
+				buffer.WriteByte(' ')
+			} else {
+				buffer.WriteString(html.EscapeString(cell.text))
+			}
+		}
+		if open {
+			buffer.WriteString("</span>")
+		}
+		if y < len(terminal.screen)-1 {
+			buffer.WriteByte('\n')
+		}
+	}
+	buffer.WriteString("</pre>\n")
+	return buffer.String()
+}
+
+// blank returns true when the terminal is in the state of a new terminal,
+// so that its snapshot would change nothing.
+func (terminal *terminal) blank() bool {
+	if len(terminal.history) > 0 || terminal.inAlternateScreen() ||
+		terminal.cursorX != 0 || terminal.cursorY != 0 || terminal.style != defaultTerminalStyle ||
+		terminal.top != 0 || terminal.bottom != terminal.height-1 {
+		return false
+	}
+	for mode, value := range terminal.modes {
+		if value != terminalModes[mode] {
+			return false
+		}
+	}
+	for _, line := range terminal.main {
+		if !blankTerminalLine(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot returns the output to reproduce the current state on a new terminal.
+// The history and the main screen are printed as lines so that they go into
+// the scrollback of the client.
+func (terminal *terminal) snapshot() []byte {
+	var buffer bytes.Buffer
+
+	lines := append(append([][]terminalCell{}, terminal.history...), terminal.main...)
+	for i, line := range lines {
+		writeSnapshotLine(&buffer, line)
+		if i < len(lines)-1 {
+			buffer.WriteString("\r\n")
+		}
+	}
+
+	if terminal.inAlternateScreen() {
+		buffer.WriteString("\x1b[?1049h")
+		for y, line := range terminal.alternate {
+			fmt.Fprintf(&buffer, "\x1b[%dH", y+1)
+			writeSnapshotLine(&buffer, line)
+		}
+	}
+
+	if terminal.top != 0 || terminal.bottom != terminal.height-1 {
+		fmt.Fprintf(&buffer, "\x1b[%d;%dr", terminal.top+1, terminal.bottom+1)
+	}
+	fmt.Fprintf(&buffer, "\x1b[%d;%dH", terminal.cursorY+1, terminal.cursorX+1)
+	buffer.WriteString(sgrSequence(terminal.style))
+
+	modes := []int{}
+	for mode := range terminal.modes {
+		modes = append(modes, mode)
+	}
+	sort.Ints(modes)
+	for _, mode := range modes {
+		if terminal.modes[mode] {
+			fmt.Fprintf(&buffer, "\x1b[?%dh", mode)
+		} else {
+			fmt.Fprintf(&buffer, "\x1b[?%dl", mode)
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+func writeSnapshotLine(buffer *bytes.Buffer, line []terminalCell) {
+	// Blank cells at the end are not printed
+	end := len(line)
+	for end > 0 && line[end-1].text == "" && line[end-1].style == defaultTerminalStyle {
+		end--
+	}
+
+	current := defaultTerminalStyle
+	for x := 0; x < end; x++ {
+		cell := &line[x]
+		if isWideTail(line, x) {
+			continue
+		}
+		if cell.style != current {
+			current = cell.style
+			buffer.WriteString(sgrSequence(current))
+		}
+		if cell.text == "" {
+			buffer.WriteByte(' ')
+		} else {
+			buffer.WriteString(cell.text)
+		}
+	}
+	if current != defaultTerminalStyle {
+		buffer.WriteString("\x1b[0m")
+	}
+}
+
+func sgrSequence(style terminalStyle) string {
+	params := []string{"0"}
+	flags := []struct {
+		flag  uint8
+		param string
+	}{
+		{styleBold, "1"}, {styleFaint, "2"}, {styleItalic, "3"}, {styleUnderline, "4"},
+		{styleBlink, "5"}, {styleReverse, "7"}, {styleHidden, "8"}, {styleStrike, "9"},
+	}
+	for _, f := range flags {
+		if style.flags&f.flag != 0 {
+			params = append(params, f.param)
+		}
+	}
+	params = append(params, colorParams(style.fg, 30)...)
+	params = append(params, colorParams(style.bg, 40)...)
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+func colorParams(color int32, base int) []string {
+	switch {
+	case color == terminalDefaultColor:
+		return nil
+	case color&terminalRGBColor != 0:
+		return []string{strconv.Itoa(base + 8), "2",
+			strconv.Itoa(int(color>>16) & 0xff), strconv.Itoa(int(color>>8) & 0xff), strconv.Itoa(int(color) & 0xff)}
+	case color < 8:
+		return []string{strconv.Itoa(base + int(color))}
+	case color < 16:
+		return []string{strconv.Itoa(base + 60 + int(color) - 8)}
+	default:
+		return []string{strconv.Itoa(base + 8), "5", strconv.Itoa(int(color))}
+	}
+}
+
+// The default colors of xterm
+var basicColors = [16]int32{
+	0x000000, 0xcd0000, 0x00cd00, 0xcdcd00, 0x0000ee, 0xcd00cd, 0x00cdcd, 0xe5e5e5,
+	0x7f7f7f, 0xff0000, 0x00ff00, 0xffff00, 0x5c5cff, 0xff00ff, 0x00ffff, 0xffffff,
+}
+
+func colorRGB(color int32) int32 {
+	switch {
+	case color&terminalRGBColor != 0:
+		return color &^ terminalRGBColor
+	case color < 16:
+		return basicColors[color]
+	case color < 232:
+		// 6x6x6 color cube
+		levels := [6]int32{0, 95, 135, 175, 215, 255}
+		color -= 16
+		return levels[color/36]<<16 | levels[color/6%6]<<8 | levels[color%6]
+	default:
+		level := 8 + (color-232)*10
+		return level<<16 | level<<8 | level
+	}
+}
+
+func styleCSS(style terminalStyle) string {
+	fg, bg := style.fg, style.bg
+	if style.flags&styleReverse != 0 {
+		fg, bg = bg, fg
+		if fg == terminalDefaultColor {
+			fg = 0x101010 | terminalRGBColor
+		}
+		if bg == terminalDefaultColor {
+			bg = 0xf0f0f0 | terminalRGBColor
+		}
+	}
+	if style.flags&styleBold != 0 && fg >= 0 && fg < 8 {
+		fg += 8
+	}
+
+	css := []string{}
+	if fg != terminalDefaultColor {
+		css = append(css, fmt.Sprintf("color: #%06x", colorRGB(fg)))
+	}
+	if bg != terminalDefaultColor {
+		css = append(css, fmt.Sprintf("background: #%06x", colorRGB(bg)))
+	}
+	if style.flags&styleBold != 0 {
+		css = append(css, "font-weight: bold")
+	}
+	if style.flags&styleFaint != 0 {
+		css = append(css, "opacity: 0.7")
+	}
+	if style.flags&styleItalic != 0 {
+		css = append(css, "font-style: italic")
+	}
+	decorations := []string{}
+	if style.flags&styleUnderline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if style.flags&styleStrike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		css = append(css, "text-decoration: "+strings.Join(decorations, " "))
+	}
+	if style.flags&styleHidden != 0 {
+		css = append(css, "visibility: hidden")
+	}
+	return strings.Join(css, "; ")
+}
+
+// runeWidth returns the number of cells the character takes on the terminal.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200d || unicode.In(r, unicode.Mn, unicode.Me):
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0x303e,
+		r >= 0x3041 && r <= 0x33ff,
+		r >= 0x3400 && r <= 0x4dbf,
+		r >= 0x4e00 && r <= 0x9fff,
+		r >= 0xa000 && r <= 0xa4cf,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func clamp(value int, min int, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
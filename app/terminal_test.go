@@ -0,0 +1,289 @@
+package app
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lines returns the text of the lines with trailing blanks trimmed.
+func lines(screen [][]terminalCell) []string {
+	texts := []string{}
+	for _, line := range screen {
+		text := ""
+		for x, cell := range line {
+			switch {
+			case isWideTail(line, x):
+			case cell.text == "":
+				text += " "
+			default:
+				text += cell.text
+			}
+		}
+		texts = append(texts, strings.TrimRight(text, " "))
+	}
+	return texts
+}
+
+// blanked returns a copy of the screen with spaces as blank cells,
+// which look the same.
+func blanked(screen [][]terminalCell) [][]terminalCell {
+	copied := [][]terminalCell{}
+	for _, line := range screen {
+		line = append([]terminalCell{}, line...)
+		for x := range line {
+			if line[x].text == " " {
+				line[x].text = ""
+			}
+		}
+		copied = append(copied, line)
+	}
+	return copied
+}
+
+func TestTerminal(t *testing.T) {
+	cases := []struct {
+		name          string
+		width, height int
+		input         string
+		screen        []string
+		x, y          int
+	}{
+		{"print", 10, 3, "abc", []string{"abc", "", ""}, 3, 0},
+		{"new lines", 10, 3, "ab\r\ncd\n", []string{"ab", "cd", ""}, 2, 2},
+		{"cursor position", 10, 3, "\x1b[2;4Hx\x1b[Hy\x1b[3;10Hz", []string{"y", "   x", "         z"}, 9, 2},
+		{"cursor movement", 10, 3, "\x1b[2B\x1b[5Ca\x1b[2Ab\x1b[3Dc\x1b[9Bd", []string{"    c b", "", "     d"}, 6, 2},
+		{"cursor clamped", 5, 2, "\x1b[9;9Ha\x1b[20Db", []string{"", "b   a"}, 1, 1},
+		{"backspace and tab", 20, 1, "abc\b\bx\ty", []string{"axc     y"}, 9, 0},
+		{"wrap", 5, 3, "abcdefg", []string{"abcde", "fg", ""}, 2, 1},
+		{"wrap pending", 5, 2, "abcde\r\nf", []string{"abcde", "f"}, 1, 1},
+		{"no wrap", 5, 2, "\x1b[?7labcdefg", []string{"abcdg", ""}, 4, 0},
+		{"scroll", 5, 2, "a\r\nb\r\nc", []string{"b", "c"}, 1, 1},
+		{"erase line", 10, 1, "abcdef\x1b[3D\x1b[K", []string{"abc"}, 3, 0},
+		{"erase line start", 10, 1, "abcdef\x1b[3D\x1b[1K", []string{"    ef"}, 3, 0},
+		{"erase display", 10, 3, "a\r\nbcd\r\ne\x1b[2;2H\x1b[J", []string{"a", "b", ""}, 1, 1},
+		{"insert and delete characters", 10, 1, "abcdef\x1b[4G\x1b[2@x\x1b[2P", []string{"abcxef"}, 4, 0},
+		{"insert and delete lines", 10, 4, "a\r\nb\r\nc\r\nd\x1b[2H\x1b[L\x1b[4H\x1b[M", []string{"a", "", "b", ""}, 0, 3},
+		{"wide", 10, 1, "a世b", []string{"a世b"}, 4, 0},
+		{"wide wrapped", 4, 2, "abc世", []string{"abc", "世"}, 2, 1},
+		{"wide overwritten", 10, 1, "世界\x1b[2Gx\x1b[4Gy", []string{" x y"}, 4, 0},
+		{"combining", 10, 1, "éx", []string{"éx"}, 2, 0},
+		{"wide without wrap", 3, 1, "\x1b[?7labc世", []string{"a世"}, 2, 0},
+		{"wide on a single column", 1, 2, "世a世b", []string{"a", "b"}, 0, 1},
+		{"wide on a single column without wrap", 1, 1, "\x1b[?7l世a世", []string{"a"}, 0, 0},
+		{"scroll region", 10, 4, "top\x1b[2;3r\x1b[3H1\r\n2\r\n3\x1b[r\x1b[4Hbottom", []string{"top", "2", "3", "bottom"}, 6, 3},
+		{"reverse index in scroll region", 10, 4, "a\r\nb\r\nc\r\nd\x1b[2;3r\x1b[2H\x1bMx", []string{"a", "x", "b", "d"}, 1, 1},
+		{"alternate screen", 10, 2, "main\x1b[?1049hvim\x1b[?1049l", []string{"main", ""}, 4, 0},
+		{"save and restore cursor", 10, 2, "ab\x1b7\r\ncd\x1b8e", []string{"abe", "cd"}, 3, 0},
+		{"split sequences and runes", 10, 1, "\x1b[\x32\x43\xe4\xb8", []string{""}, 2, 0},
+		{"reset", 10, 2, "abc\r\ndef\x1bc", []string{"", ""}, 0, 0},
+		{"titles and strings", 10, 1, "\x1b]0;title\x07a\x1bPq#0\x1b\\b", []string{"ab"}, 2, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			terminal := newTerminal(c.width, c.height, 0)
+			terminal.write([]byte(c.input))
+			if screen := lines(terminal.screen); !reflect.DeepEqual(screen, c.screen) {
+				t.Errorf("expected the screen %q, got %q", c.screen, screen)
+			}
+			if terminal.cursorX != c.x || terminal.cursorY != c.y {
+				t.Errorf("expected the cursor at %d,%d, got %d,%d", c.x, c.y, terminal.cursorX, terminal.cursorY)
+			}
+		})
+	}
+}
+
+func TestTerminalHistory(t *testing.T) {
+	terminal := newTerminal(10, 3, 3)
+	terminal.write([]byte("1\r\n2\r\n3\r\n4\r\n5\r\n6\r\n7"))
+	if history := lines(terminal.history); !reflect.DeepEqual(history, []string{"2", "3", "4"}) {
+		t.Fatalf("expected the last 3 lines in the history, got %q", history)
+	}
+
+	// Lines scrolled in a scrolling region or on the alternate screen are not kept
+	terminal.write([]byte("\x1b[2;3r\x1b[3H\n\n\x1b[r\x1b[?1049h\r\n\r\n\r\n\x1b[?1049l"))
+	if history := lines(terminal.history); !reflect.DeepEqual(history, []string{"2", "3", "4"}) {
+		t.Fatalf("expected the history to be unchanged, got %q", history)
+	}
+
+	terminal = newTerminal(10, 2, 0)
+	terminal.write([]byte("1\r\n2\r\n3"))
+	if len(terminal.history) != 0 {
+		t.Fatalf("expected no history, got %q", lines(terminal.history))
+	}
+}
+
+func TestTerminalResize(t *testing.T) {
+	cases := []struct {
+		name          string
+		input         string
+		width, height int
+		screen        []string
+		history       []string
+		x, y          int
+	}{
+		{"grow", "abc\r\ndef", 6, 4, []string{"abc", "def", "", ""}, []string{}, 3, 1},
+		{"narrow", "abcdef\r\nghi", 3, 3, []string{"abc", "ghi", ""}, []string{}, 2, 1},
+		{"shrink below the cursor", "abc\r\ndef", 10, 2, []string{"abc", "def"}, []string{}, 3, 1},
+		{"shrink above the cursor", "a\r\nb\r\nc", 10, 1, []string{"c"}, []string{"a", "b"}, 1, 0},
+		{"shrink the alternate screen", "main\x1b[?1049h\x1b[3Hvim", 10, 2, []string{"", "vim"}, []string{}, 3, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			terminal := newTerminal(10, 3, 100)
+			terminal.write([]byte(c.input))
+			terminal.resize(c.width, c.height)
+			if terminal.width != c.width || terminal.height != c.height {
+				t.Fatalf("expected the size %dx%d, got %dx%d", c.width, c.height, terminal.width, terminal.height)
+			}
+			if screen := lines(terminal.screen); !reflect.DeepEqual(screen, c.screen) {
+				t.Errorf("expected the screen %q, got %q", c.screen, screen)
+			}
+			if history := lines(terminal.history); !reflect.DeepEqual(history, c.history) {
+				t.Errorf("expected the history %q, got %q", c.history, history)
+			}
+			if terminal.cursorX != c.x || terminal.cursorY != c.y {
+				t.Errorf("expected the cursor at %d,%d, got %d,%d", c.x, c.y, terminal.cursorX, terminal.cursorY)
+			}
+
+			// The terminal keeps working at the new size
+			terminal.write([]byte("\x1b[Hxyz\r\n\x1b[999;999H!"))
+		})
+	}
+}
+
+func TestTerminalSnapshot(t *testing.T) {
+	inputs := map[string]string{
+		"history":          "1\r\n2\r\n3\r\n4\r\n5",
+		"styles":           "\x1b[1;31mred\x1b[0m \x1b[38;5;100mx\x1b[48;2;1;2;3my\x1b[4m",
+		"wide":             "a世b\r\n界",
+		"alternate screen": "shell\r\n$ \x1b[?1049h\x1b[2;3Hvim\x1b[?25l",
+		"scroll region":    "\x1b[2;3r\x1b[3Hx",
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			terminal := newTerminal(10, 3, 100)
+			terminal.write([]byte(input))
+
+			replayed := newTerminal(10, 3, 100)
+			replayed.write(terminal.snapshot())
+			if !reflect.DeepEqual(blanked(replayed.screen), blanked(terminal.screen)) ||
+				!reflect.DeepEqual(blanked(replayed.main), blanked(terminal.main)) {
+				t.Errorf("expected the screen %q, got %q", lines(terminal.screen), lines(replayed.screen))
+			}
+			if !reflect.DeepEqual(lines(replayed.history), lines(terminal.history)) {
+				t.Errorf("expected the history %q, got %q", lines(terminal.history), lines(replayed.history))
+			}
+			if replayed.cursorX != terminal.cursorX || replayed.cursorY != terminal.cursorY || replayed.style != terminal.style {
+				t.Errorf("expected the cursor at %d,%d, got %d,%d", terminal.cursorX, terminal.cursorY, replayed.cursorX, replayed.cursorY)
+			}
+			if replayed.top != terminal.top || replayed.bottom != terminal.bottom || !reflect.DeepEqual(replayed.modes, terminal.modes) {
+				t.Errorf("expected the scroll region and modes to be restored")
+			}
+		})
+	}
+}
+
+func TestTerminalBlank(t *testing.T) {
+	inputs := map[string]bool{
+		"":                               true,
+		"\x1b[?7h\x1b[?1049h\x1b[?1049l": true,
+		"abc\x1b[2K\r":                   true,
+		"abc\x1b[2J\x1b[H":               true,
+		"\x1b[H\x1b[Jprompt":             false,
+		"\x1b[3;5H":                      false,
+		"\x1b[?1h":                       false,
+		"\x1b[31m":                       false,
+		"\x1b[?1049h":                    false,
+		"\x1b[2;3r":                      false,
+		"1\r\n2\r\n3\r\n4\x1b[2J\x1b[H":  false,
+	}
+	for input, blank := range inputs {
+		terminal := newTerminal(10, 3, 100)
+		terminal.write([]byte(input))
+		if terminal.blank() != blank {
+			t.Errorf("expected blank to be %t after %q", blank, input)
+		}
+	}
+}
+
+func TestTerminalRandom(t *testing.T) {
+	pieces := []string{
+		"a", "世", "\u0301", "\r", "\n", "\b", "\t", "\x1b", "[", ";", "?", "0", "1", "2", "9", "999",
+		"\x1b[?7l", "\x1b[?7h", "\x1b[?1049h", "\x1b[?1049l", "\x1b[2;3r", "\x1b[r", "\x1bM", "\x1b7", "\x1b8",
+		"H", "J", "K", "@", "P", "L", "M", "A", "D", "m", "\xe4\xb8", "\x9b", "\x1b]0;",
+	}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		terminal := newTerminal(1+random.Intn(4), 1+random.Intn(4), random.Intn(3))
+		input := ""
+		for j := 0; j < 100; j++ {
+			if random.Intn(20) == 0 {
+				terminal.write([]byte(input))
+				input = ""
+				terminal.resize(1+random.Intn(4), 1+random.Intn(4))
+			}
+			input += pieces[random.Intn(len(pieces))]
+		}
+		terminal.write([]byte(input))
+
+		if terminal.cursorX < 0 || terminal.cursorX >= terminal.width || terminal.cursorY < 0 || terminal.cursorY >= terminal.height {
+			t.Fatalf("expected the cursor within %dx%d, got %d,%d after %q", terminal.width, terminal.height, terminal.cursorX, terminal.cursorY, input)
+		}
+		if len(terminal.screen) != terminal.height {
+			t.Fatalf("expected %d lines, got %d after %q", terminal.height, len(terminal.screen), input)
+		}
+		for _, line := range terminal.screen {
+			if len(line) != terminal.width {
+				t.Fatalf("expected lines of %d cells, got %d after %q", terminal.width, len(line), input)
+			}
+		}
+		for _, line := range terminal.history {
+			if len(line) > terminal.width {
+				t.Fatalf("expected history lines of at most %d cells, got %d after %q", terminal.width, len(line), input)
+			}
+		}
+		newTerminal(terminal.width, terminal.height, 0).write(terminal.snapshot())
+	}
+}
+
+func TestTerminalText(t *testing.T) {
+	terminal := newTerminal(8, 3, 0)
+	terminal.write([]byte("\x1b[31mred\x1b[0m 世界\r\n\r\n  x "))
+	if text := terminal.text(); text != "red 世界\n\n  x\n" {
+		t.Fatalf("unexpected text %q", text)
+	}
+}
+
+func TestTerminalHTML(t *testing.T) {
+	terminal := newTerminal(6, 2, 0)
+	terminal.write([]byte("\x1b[1;31m<b>\x1b[0m&\r\n\x1b[7m世\x1b[0m"))
+	expected := `<pre class="gotty-screen" style="color: #f0f0f0; background: #101010;">` +
+		`<span style="color: #ff0000; font-weight: bold">&lt;b&gt;</span><span>&amp;  </span>` + "\n" +
+		`<span style="color: #101010; background: #f0f0f0">世</span><span>    </span></pre>` + "\n"
+	if html := terminal.html(); html != expected {
+		t.Fatalf("expected the HTML\n%s\ngot\n%s", expected, html)
+	}
+}
+
+func TestStyleCSS(t *testing.T) {
+	cases := []struct {
+		style terminalStyle
+		css   string
+	}{
+		{defaultTerminalStyle, ""},
+		{terminalStyle{fg: 1, bg: terminalDefaultColor}, "color: #cd0000"},
+		{terminalStyle{fg: 1, bg: terminalDefaultColor, flags: styleBold}, "color: #ff0000; font-weight: bold"},
+		{terminalStyle{fg: 196, bg: 244}, "color: #ff0000; background: #808080"},
+		{terminalStyle{fg: 0x123456 | terminalRGBColor, bg: terminalDefaultColor}, "color: #123456"},
+		{terminalStyle{fg: 2, bg: 4, flags: styleReverse}, "color: #0000ee; background: #00cd00"},
+		{terminalStyle{fg: terminalDefaultColor, bg: terminalDefaultColor, flags: styleUnderline | styleStrike | styleItalic},
+			"font-style: italic; text-decoration: underline line-through"},
+	}
+	for _, c := range cases {
+		if css := styleCSS(c.style); css != c.css {
+			t.Errorf("expected %q for %+v, got %q", c.css, c.style, css)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"os"
 	"reflect"
 	"strings"
 
@@ -34,7 +35,7 @@ func generateFlags(flags []flag, hint map[string]string) ([]cli.Flag, error) {
 		if flag.shortName != "" {
 			flagName += ", " + flag.shortName
 		}
-		envName := "GOTTY_" + strings.ToUpper(strings.Join(strings.Split(flag.name, "-"), "_"))
+		envName := envName(flag.name)
 
 		switch field.Kind() {
 		case reflect.String:
@@ -73,7 +74,7 @@ func applyFlags(
 ) {
 	o := structs.New(options)
 	for _, flag := range flags {
-		if c.IsSet(flag.name) {
+		if isSet(c, flag.name) {
 			field := o.Field(fieldName(flag.name, mappingHint))
 			var val interface{}
 			switch field.Kind() {
@@ -89,6 +90,15 @@ func applyFlags(
 	}
 }
 
+// isSet returns whether the flag is given on the command line or by its environment variable.
+func isSet(c *cli.Context, name string) bool {
+	return c.IsSet(name) || os.Getenv(envName(name)) != ""
+}
+
+func envName(name string) string {
+	return "GOTTY_" + strings.ToUpper(strings.Join(strings.Split(name, "-"), "_"))
+}
+
 func fieldName(name string, hint map[string]string) string {
 	if fieldName, ok := hint[name]; ok {
 		return fieldName
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/cli"
+
+	"github.com/yudai/gotty/app"
+)
+
+// readTestOptions reads the options like gotty does with the arguments.
+func readTestOptions(t *testing.T, args ...string) *app.Options {
+	flags := []flag{
+		flag{"port", "p", ""},
+		flag{"credential", "c", ""},
+		flag{"permit-write", "w", ""},
+		flag{"max-connection", "", ""},
+		flag{"log-format", "", ""},
+	}
+	cliFlags, err := generateFlags(flags, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var options *app.Options
+	cmd := cli.NewApp()
+	cmd.Flags = append(cliFlags, cli.StringFlag{Name: "config", Value: "~/.gotty"})
+	cmd.Action = func(c *cli.Context) {
+		options, err = readOptions(c, flags, nil)
+	}
+	cmd.Run(append([]string{"gotty"}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return options
+}
+
+func TestReadOptionsEnvironment(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "gotty")
+	if err := ioutil.WriteFile(config, []byte("port = \"9000\"\nmax_connection = 3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := readTestOptions(t, "--config", config)
+	if options.Port != "9000" || options.MaxConnection != 3 || options.EnableBasicAuth || options.PermitWrite {
+		t.Fatalf("expected the options of the config file, got %+v", options)
+	}
+
+	// Environment variables take precedence over the config file like flags
+	for name, value := range map[string]string{
+		"GOTTY_PORT":         "9001",
+		"GOTTY_CREDENTIAL":   "alice:secret",
+		"GOTTY_PERMIT_WRITE": "true",
+	} {
+		t.Setenv(name, value)
+	}
+	options = readTestOptions(t, "--config", config)
+	if options.Port != "9001" || options.Credential != "alice:secret" || !options.EnableBasicAuth || !options.PermitWrite {
+		t.Fatalf("expected the options of the environment variables, got %+v", options)
+	}
+	if options.MaxConnection != 3 {
+		t.Fatalf("expected the options not in the environment from the config file, got %d", options.MaxConnection)
+	}
+
+	// Flags take precedence over environment variables
+	options = readTestOptions(t, "--config", config, "-p", "9002")
+	if options.Port != "9002" {
+		t.Fatalf("expected the port of the flag, got %s", options.Port)
+	}
+}
+
+func TestReadOptionsLogFormat(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "gotty")
+	if err := ioutil.WriteFile(config, []byte("port = \"9000\"\nprot = \"9001\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+	original := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = original }()
+
+	readTestOptions(t, "--config", config, "--log-format", "json")
+
+	logged, err := ioutil.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(logged)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"Loaded config file"`) || !strings.Contains(lines[1], `"level":"WARN"`) || !strings.Contains(lines[1], "prot") {
+		t.Fatalf("expected the messages of the config file in JSON, got %q", logged)
+	}
+}
@@ -5,6 +5,9 @@ var helpTemplate = `NAME:
 
 USAGE:
    {{.Name}} [options] <command> [<arguments...>]
+   {{.Name}} [options] replay <file.cast>
+   {{.Name}} [options] config check [<file>]
+   {{.Name}} [options] config show
 
 VERSION:
    {{.Version}}{{if or .Author .Email}}
@@ -23,12 +23,26 @@ func main() {
 		flag{"port", "p", "Port number to listen"},
 		flag{"permit-write", "w", "Permit clients to write to the TTY (BE CAREFUL)"},
 		flag{"credential", "c", "Credential for Basic Authentication (ex: user:pass, default disabled)"},
+		flag{"htpasswd-file", "", "htpasswd file with bcrypt hashed passwords of users for Basic Authentication"},
+		flag{"token-file", "", "File of user:token lines with static tokens to accept"},
+		flag{"oidc-issuer", "", "Issuer URL of the OpenID Connect provider to log in with (default disabled)"},
+		flag{"oidc-client-id", "", "OpenID Connect client ID"},
+		flag{"oidc-client-secret", "", "OpenID Connect client secret"},
+		flag{"oidc-redirect-url", "", "OpenID Connect redirect URL, derived from the request when empty"},
+		flag{"oidc-allowed-domains", "", "Comma separated email domains of users allowed to log in"},
+		flag{"oidc-allowed-groups", "", "Comma separated groups of users allowed to log in"},
+		flag{"operators", "", "Comma separated users permitted to write to the TTY regardless of --permit-write"},
+		flag{"viewers", "", "Comma separated users not permitted to write to the TTY regardless of --permit-write"},
+		flag{"admin-credential", "", "Credential for the admin API to list and close sessions (ex: user:pass, default disabled)"},
+		flag{"metrics", "", "Export metrics for Prometheus at /metrics"},
 		flag{"random-url", "r", "Add a random string to the URL"},
 		flag{"random-url-length", "", "Random URL length"},
 		flag{"tls", "t", "Enable TLS/SSL"},
 		flag{"tls-crt", "", "TLS/SSL certificate file path"},
 		flag{"tls-key", "", "TLS/SSL key file path"},
 		flag{"tls-ca-crt", "", "TLS/SSL CA certificate file for client certifications"},
+		flag{"ssh-server-port", "", "Port number to listen for SSH clients (default disabled)"},
+		flag{"ssh-server-host-key", "", "Host key file of the SSH server"},
 		flag{"index", "", "Custom index.html file"},
 		flag{"title-format", "", "Title format of browser window"},
 		flag{"reconnect", "", "Enable reconnection"},
@@ -36,20 +50,53 @@ func main() {
 		flag{"timeout", "", "Timeout seconds for waiting a client (0 to disable)"},
 		flag{"max-connection", "", "Maximum connection to gotty, 0(default) means no limit"},
 		flag{"once", "", "Accept only one client and exit on disconnection"},
+		flag{"propagate-exit-code", "", "Exit with the exit code of the command in once mode"},
+		flag{"shared", "", "Share a single process among all clients and keep it running across disconnections"},
+		flag{"session-grace-period", "", "Seconds to keep the process of a disconnected client for it to reconnect, 0(default) means close it immediately"},
+		flag{"scrollback-lines", "", "Lines scrolled off the screen to keep for clients attaching to a running process"},
+		flag{"snapshot", "", "Serve the current screen of processes at snapshot under the path of the command"},
+		flag{"record-dir", "", "Directory to record sessions into as asciicast v2 files (default disabled)"},
+		flag{"compression", "", "Enable permessage-deflate compression of websocket messages"},
+		flag{"output-latency", "", "Milliseconds to wait for more output before sending it to clients, 0(default) means send immediately"},
+		flag{"output-buffer-size", "", "Bytes of output to read at once and coalesce into a single message"},
 		flag{"permit-arguments", "", "Permit clients to send command line arguments in URL (e.g. http://example.com:8080/?arg=AAA&arg=BBB)"},
 		flag{"close-signal", "", "Signal sent to the command process when gotty close it (default: SIGHUP)"},
+		flag{"backend", "", "Backend to run the command on, pty, ssh, tcp or unix"},
+		flag{"ssh-identity-file", "", "Private key file to authenticate with the ssh backend"},
+		flag{"ssh-password", "", "Password to authenticate with the ssh backend"},
+		flag{"ssh-use-agent", "", "Authenticate with the ssh backend using the agent at SSH_AUTH_SOCK"},
+		flag{"ssh-known-hosts-file", "", "known_hosts file to verify hosts of the ssh backend"},
 		flag{"width", "", "Static width of the screen, 0(default) means dynamically resize"},
 		flag{"height", "", "Static height of the screen, 0(default) means dynamically resize"},
+		flag{"log-format", "", "Format of log lines, text or json"},
+		flag{"log-level", "", "Minimum level of log lines, debug, info, warn or error"},
 	}
 
 	mappingHint := map[string]string{
-		"index":      "IndexFile",
-		"tls":        "EnableTLS",
-		"tls-crt":    "TLSCrtFile",
-		"tls-key":    "TLSKeyFile",
-		"tls-ca-crt": "TLSCACrtFile",
-		"random-url": "EnableRandomUrl",
-		"reconnect":  "EnableReconnect",
+		"index":       "IndexFile",
+		"tls":         "EnableTLS",
+		"tls-crt":     "TLSCrtFile",
+		"tls-key":     "TLSKeyFile",
+		"tls-ca-crt":  "TLSCACrtFile",
+		"random-url":  "EnableRandomUrl",
+		"reconnect":   "EnableReconnect",
+		"compression": "EnableCompression",
+		"metrics":     "EnableMetrics",
+		"snapshot":    "EnableSnapshot",
+
+		"oidc-issuer":          "OIDCIssuer",
+		"oidc-client-id":       "OIDCClientID",
+		"oidc-client-secret":   "OIDCClientSecret",
+		"oidc-redirect-url":    "OIDCRedirectURL",
+		"oidc-allowed-domains": "OIDCAllowedDomains",
+		"oidc-allowed-groups":  "OIDCAllowedGroups",
+
+		"ssh-server-port":      "SSHServerPort",
+		"ssh-server-host-key":  "SSHServerHostKey",
+		"ssh-identity-file":    "SSHIdentityFile",
+		"ssh-password":         "SSHPassword",
+		"ssh-use-agent":        "SSHUseAgent",
+		"ssh-known-hosts-file": "SSHKnownHostsFile",
 	}
 
 	cliFlags, err := generateFlags(flags, mappingHint)
@@ -68,51 +115,174 @@ func main() {
 	)
 
 	cmd.Action = func(c *cli.Context) {
-		if len(c.Args()) == 0 {
-			fmt.Println("Error: No command given.\n")
+		options := loadOptions(c, flags, mappingHint)
+
+		// Commands in the config file are listed on an index page instead
+		if len(c.Args()) == 0 && len(options.Commands) == 0 {
+			fmt.Print("Error: No command given.\n\n")
 			cli.ShowAppHelp(c)
 			exit(err, 1)
 		}
 
-		options := app.DefaultOptions
-
-		configFile := c.String("config")
-		_, err := os.Stat(app.ExpandHomeDir(configFile))
-		if configFile != "~/.gotty" || !os.IsNotExist(err) {
-			if err := app.ApplyConfigFile(&options, configFile); err != nil {
-				exit(err, 2)
-			}
+		app, err := app.New(c.Args(), options)
+		if err != nil {
+			exit(err, 3)
 		}
 
-		applyFlags(&options, flags, mappingHint, c)
+		registerSignals(app, func() {
+			options, err := readOptions(c, flags, mappingHint)
+			if err == nil {
+				err = app.Reload(options)
+			}
+			if err != nil {
+				app.Logger().Error("Failed to reload configuration", "error", err)
+			}
+		})
 
-		if c.IsSet("credential") {
-			options.EnableBasicAuth = true
-		}
-		if c.IsSet("tls-ca-crt") {
-			options.EnableTLSClientAuth = true
+		err = app.Run()
+		if err != nil {
+			exit(err, 4)
 		}
 
-		if err := app.CheckConfig(&options); err != nil {
-			exit(err, 6)
+		if options.PropagateExitCode {
+			if code, ok := app.ExitCode(); ok {
+				os.Exit(code)
+			}
 		}
+	}
+
+	cmd.Commands = []cli.Command{
+		{
+			Name:     "replay",
+			Usage:    "Play a recorded asciicast v2 file to clients",
+			HideHelp: true,
+			Action: func(c *cli.Context) {
+				if len(c.Args()) != 1 {
+					fmt.Print("Error: No asciicast file given.\n\n")
+					cli.ShowAppHelp(c.Parent())
+					exit(nil, 1)
+				}
+
+				options := loadOptions(c.Parent(), flags, mappingHint)
+
+				app, err := app.NewReplay(c.Args().First(), options)
+				if err != nil {
+					exit(err, 3)
+				}
 
-		app, err := app.New(c.Args(), &options)
+				registerSignals(app, nil)
+
+				err = app.Run()
+				if err != nil {
+					exit(err, 4)
+				}
+			},
+		},
+		{
+			Name:     "config",
+			Usage:    "Check the config file or show the options in effect",
+			HideHelp: true,
+			Action: func(c *cli.Context) {
+				fmt.Print("Error: No subcommand given, must be check or show.\n\n")
+				cli.ShowAppHelp(c.Parent())
+				exit(nil, 1)
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:     "check",
+					Usage:    "Report unknown options, invalid values and invalid combinations in the config file",
+					HideHelp: true,
+					Action: func(c *cli.Context) {
+						// The context of the subcommand is under the one of the config command
+						root := c.Parent().Parent()
+						configFile := root.String("config")
+						if len(c.Args()) > 0 {
+							configFile = c.Args().First()
+						}
+
+						problems := app.CheckConfigFile(configFile)
+						for _, problem := range problems {
+							fmt.Println(configFile + ": " + problem.Error())
+						}
+						if len(problems) > 0 {
+							exit(nil, 6)
+						}
+						fmt.Println(configFile + ": OK")
+					},
+				},
+				{
+					Name:     "show",
+					Usage:    "Print the options in effect after the config file, environment variables and flags, with credentials redacted",
+					HideHelp: true,
+					Action: func(c *cli.Context) {
+						options, err := readOptions(c.Parent().Parent(), flags, mappingHint)
+						if err != nil {
+							exit(err, 2)
+						}
+
+						config, err := app.FormatConfig(options)
+						if err != nil {
+							exit(err, 2)
+						}
+						fmt.Println(string(config))
+					},
+				},
+			},
+		},
+	}
+
+	cli.AppHelpTemplate = helpTemplate
+
+	cmd.Run(os.Args)
+}
+
+func loadOptions(c *cli.Context, flags []flag, mappingHint map[string]string) *app.Options {
+	options, err := readOptions(c, flags, mappingHint)
+	if err != nil {
+		exit(err, 2)
+	}
+
+	if err := app.CheckConfig(options); err != nil {
+		exit(err, 6)
+	}
+
+	return options
+}
+
+// readOptions reads the config file and applies the flags over it.
+func readOptions(c *cli.Context, flags []flag, mappingHint map[string]string) (*app.Options, error) {
+	options := app.DefaultOptions
+
+	configFile := c.String("config")
+	_, err := os.Stat(app.ExpandHomeDir(configFile))
+	configLoaded := configFile != "~/.gotty" || !os.IsNotExist(err)
+	warnings := []string{}
+	if configLoaded {
+		warnings, err = app.ApplyConfigFile(&options, configFile)
 		if err != nil {
-			exit(err, 3)
+			return nil, err
 		}
+	}
 
-		registerSignals(app)
+	applyFlags(&options, flags, mappingHint, c)
 
-		err = app.Run()
-		if err != nil {
-			exit(err, 4)
+	// Logged with the log options of the flags as well,
+	// invalid log options are reported by CheckConfig
+	if logger, err := app.NewLogger(os.Stderr, &options); err == nil && configLoaded {
+		logger.Info("Loaded config file", "path", app.ExpandHomeDir(configFile))
+		for _, warning := range warnings {
+			logger.Warn(warning, "path", app.ExpandHomeDir(configFile))
 		}
 	}
 
-	cli.AppHelpTemplate = helpTemplate
+	if isSet(c, "credential") {
+		options.EnableBasicAuth = true
+	}
+	if isSet(c, "tls-ca-crt") {
+		options.EnableTLSClientAuth = true
+	}
 
-	cmd.Run(os.Args)
+	return &options, nil
 }
 
 func exit(err error, code int) {
@@ -122,13 +292,17 @@ func exit(err error, code int) {
 	os.Exit(code)
 }
 
-func registerSignals(app *app.App) {
+// registerSignals exits on SIGINT and SIGTERM, and calls reload on SIGHUP unless it's nil.
+func registerSignals(app *app.App, reload func()) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(
 		sigChan,
 		syscall.SIGINT,
 		syscall.SIGTERM,
 	)
+	if reload != nil {
+		signal.Notify(sigChan, syscall.SIGHUP)
+	}
 
 	go func() {
 		for {
@@ -140,6 +314,8 @@ func registerSignals(app *app.App) {
 				} else {
 					os.Exit(5)
 				}
+			case syscall.SIGHUP:
+				reload()
 			}
 		}
 	}()
@@ -2,18 +2,28 @@
     var httpsEnabled = window.location.protocol == "https:";
     var args = window.location.search;
     var url = (httpsEnabled ? 'wss://' : 'ws://') + window.location.host + window.location.pathname + 'ws';
-    var protocols = ["gotty"];
+    var protocols = ["gotty.binary", "gotty"];
     var autoReconnect = -1;
+    var sessionID = "";
+    var replayControls;
 
     var openWs = function() {
+        fetchAuthToken(connect);
+    };
+
+    var connect = function(authToken) {
         var ws = new WebSocket(url, protocols);
+        ws.binaryType = "arraybuffer";
 
         var term;
 
         var pingTimer;
 
+        // Set when the command exits before the connection is closed
+        var exitStatus;
+
         ws.onopen = function(event) {
-            ws.send(JSON.stringify({ Arguments: args, AuthToken: gotty_auth_token,}));
+            ws.send(JSON.stringify({ Arguments: args, AuthToken: authToken, SessionID: sessionID,}));
             pingTimer = setInterval(sendPing, 30 * 1000, ws);
 
             hterm.defaultStorage = new lib.Storage.Local();
@@ -50,10 +60,27 @@
         };
 
         ws.onmessage = function(event) {
-            data = event.data.slice(1);
-            switch(event.data[0]) {
+            var type;
+            var data;
+            if (event.data instanceof ArrayBuffer) {
+                // gotty.binary: a type byte followed by the raw payload
+                var bytes = new Uint8Array(event.data);
+                type = String.fromCharCode(bytes[0]);
+                data = bytesToString(bytes.subarray(1));
+                if (type != '0') {
+                    data = decodeURIComponent(escape(data));
+                }
+            } else {
+                type = event.data[0];
+                data = event.data.slice(1);
+                if (type == '0') {
+                    data = window.atob(data);
+                }
+            }
+
+            switch(type) {
             case '0':
-                term.io.writeUTF8(window.atob(data));
+                term.io.writeUTF8(data);
                 break;
             case '1':
                 // pong
@@ -72,13 +99,36 @@
                 autoReconnect = JSON.parse(data);
                 console.log("Enabling reconnect: " + autoReconnect + " seconds")
                 break;
+            case '5':
+                if (!replayControls) {
+                    replayControls = createReplayControls();
+                }
+                replayControls.update(ws, JSON.parse(data));
+                break;
+            case '6':
+                // Sent back on reconnection to reattach to the same process
+                sessionID = data;
+                break;
+            case '7':
+                term.io.showOverlay(data, 10000);
+                break;
+            case '8':
+                exitStatus = JSON.parse(data);
+                console.log("Command exited: " + data);
+                break;
+            case '9':
+                // Replays resize the terminal as recorded
+                var size = JSON.parse(data);
+                term.setWidth(size.Columns);
+                term.setHeight(size.Rows);
+                break;
             }
         };
 
         ws.onclose = function(event) {
             if (term) {
                 term.uninstallKeyboard();
-                term.io.showOverlay("Connection Closed", null);
+                term.io.showOverlay(exitMessage(exitStatus), null);
             }
             clearInterval(pingTimer);
             if (autoReconnect > 0) {
@@ -88,9 +138,131 @@
     }
 
 
+    var exitMessage = function(exitStatus) {
+        if (!exitStatus) {
+            return "Connection Closed";
+        }
+        if (exitStatus.Signal > 0) {
+            return "Command Killed by Signal " + exitStatus.Signal;
+        }
+        return "Command Exited with Code " + exitStatus.Code;
+    };
+
+    // Converts bytes into a string of char codes 0-255, as hterm expects for UTF-8 input
+    var bytesToString = function(bytes) {
+        var chunks = [];
+        for (var i = 0; i < bytes.length; i += 8192) {
+            chunks.push(String.fromCharCode.apply(null, bytes.subarray(i, i + 8192)));
+        }
+        return chunks.join("");
+    };
+
+    // Fetches a single use token to authenticate a new connection with
+    var fetchAuthToken = function(callback) {
+        var xhr = new XMLHttpRequest();
+        xhr.open("GET", window.location.pathname + "auth_token");
+        xhr.onload = function() {
+            callback(xhr.status == 200 ? JSON.parse(xhr.responseText).Token : "");
+        };
+        xhr.onerror = function() {
+            callback("");
+        };
+        xhr.send();
+    };
+
     var sendPing = function(ws) {
         ws.send("1");
     }
 
+    var createReplayControls = function() {
+        var ws;
+        var status;
+        var updatedAt;
+        var seeking = false;
+
+        var send = function(control) {
+            ws.send("3" + JSON.stringify(control));
+        };
+
+        var formatTime = function(seconds) {
+            seconds = Math.floor(seconds);
+            var s = seconds % 60;
+            return Math.floor(seconds / 60) + ":" + (s < 10 ? "0" : "") + s;
+        };
+
+        var bar = document.createElement("div");
+        bar.style.cssText = "position: absolute; left: 0px; right: 0px; bottom: 0px; height: 28px; " +
+            "display: flex; align-items: center; padding: 0px 8px; " +
+            "background: rgb(32, 32, 32); color: rgb(240, 240, 240); font: 12px monospace;";
+
+        var button = document.createElement("button");
+        button.style.width = "60px";
+        button.onclick = function() {
+            send({ Action: status.Playing ? "pause" : "play" });
+        };
+
+        var seek = document.createElement("input");
+        seek.type = "range";
+        seek.min = 0;
+        seek.step = 0.1;
+        seek.style.cssText = "flex: 1; margin: 0px 8px;";
+        seek.onmousedown = function() { seeking = true; };
+        seek.onchange = function() {
+            seeking = false;
+            send({ Action: "seek", Position: parseFloat(seek.value) });
+        };
+
+        var time = document.createElement("span");
+
+        var speed = document.createElement("select");
+        speed.style.marginLeft = "8px";
+        [0.5, 1, 2, 4, 8].forEach(function(value) {
+            var option = document.createElement("option");
+            option.value = value;
+            option.text = value + "x";
+            speed.appendChild(option);
+        });
+        speed.onchange = function() {
+            send({ Action: "speed", Speed: parseFloat(speed.value) });
+        };
+
+        bar.appendChild(button);
+        bar.appendChild(seek);
+        bar.appendChild(time);
+        bar.appendChild(speed);
+        document.body.appendChild(bar);
+        document.getElementById("terminal").style.height = "calc(100% - 28px)";
+
+        var render = function() {
+            var position = status.Position;
+            if (status.Playing) {
+                position += (Date.now() - updatedAt) / 1000 * status.Speed;
+            }
+            position = Math.min(position, status.Duration);
+            button.textContent = status.Playing ? "Pause" : "Play";
+            seek.max = status.Duration;
+            if (!seeking) {
+                seek.value = position;
+            }
+            time.textContent = formatTime(position) + " / " + formatTime(status.Duration);
+            speed.value = status.Speed;
+        };
+
+        setInterval(function() {
+            if (status) {
+                render();
+            }
+        }, 250);
+
+        return {
+            update: function(newWs, newStatus) {
+                ws = newWs;
+                status = newStatus;
+                updatedAt = Date.now();
+                render();
+            }
+        };
+    };
+
     openWs();
 })()